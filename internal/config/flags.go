@@ -3,11 +3,26 @@ package config
 import "github.com/urfave/cli/v2"
 
 const (
-	ConfigsFlag   = "configs"
-	VarFlag       = "var"
-	TargetFlag    = "target"
-	VerboseFlag   = "verbose"
-	DirectoryFlag = "directory"
+	ConfigsFlag         = "configs"
+	VarFlag             = "var"
+	TargetFlag          = "target"
+	VerboseFlag         = "verbose"
+	DirectoryFlag       = "directory"
+	ReportFlag          = "report"
+	FailFastFlag        = "fail-fast"
+	ParallelFlag        = "parallel"
+	ListenFlag          = "listen"
+	IgnoreFlag          = "ignore"
+	UpdateSnapshotsFlag = "update-snapshots"
+	EnvFlag             = "env"
+	OutputFlag          = "output"
+)
+
+const (
+	// TextOutput is the default value of output flag, problems and fails are only logged
+	TextOutput = "text"
+	// GithubOutput is a value of output flag to print problems and fails as GitHub workflow annotations
+	GithubOutput = "github"
 )
 
 var (
@@ -35,6 +50,43 @@ var (
 		Value:    ".",
 		Required: true,
 	}
+	ReportFlagSetup = &cli.StringSliceFlag{
+		Name:  "report",
+		Value: cli.NewStringSlice(),
+		Usage: "write run report to the file, format: type=path (supported types: junit)",
+	}
+	FailFastFlagSetup = &cli.BoolFlag{
+		Name:  "fail-fast",
+		Usage: "stop the run on the first failed test case",
+	}
+	ParallelFlagSetup = &cli.IntFlag{
+		Name:  "parallel",
+		Value: 1,
+		Usage: "number of independent test cases to run in parallel",
+	}
+	ListenFlagSetup = &cli.StringFlag{
+		Name:  "listen",
+		Value: "localhost:9000",
+		Usage: "address of the mock server, format: host:port",
+	}
+	IgnoreFlagSetup = &cli.StringSliceFlag{
+		Name:  "ignore",
+		Value: cli.NewStringSlice(),
+		Usage: "response fields which are not recorded, format: path.to.field",
+	}
+	UpdateSnapshotsFlagSetup = &cli.BoolFlag{
+		Name:  "update-snapshots",
+		Usage: "write actual responses to snapshot files instead of comparing them, missing snapshots are created only with it",
+	}
+	EnvFlagSetup = &cli.StringFlag{
+		Name:  "env",
+		Usage: "environment which config files are layered over the base ones, like services.{env}.yaml",
+	}
+	OutputFlagSetup = &cli.StringFlag{
+		Name:  "output",
+		Value: TextOutput,
+		Usage: "format of problems and fails: text or github (annotations of GitHub workflows)",
+	}
 )
 
 type ContextWrapper struct {
@@ -64,3 +116,35 @@ func (ctx ContextWrapper) VerboseFlag() bool {
 func (ctx ContextWrapper) DirectoryFlag() string {
 	return ctx.String(DirectoryFlag)
 }
+
+func (ctx ContextWrapper) ReportFlag() []string {
+	return ctx.StringSlice(ReportFlag)
+}
+
+func (ctx ContextWrapper) FailFastFlag() bool {
+	return ctx.Bool(FailFastFlag)
+}
+
+func (ctx ContextWrapper) ParallelFlag() int {
+	return ctx.Int(ParallelFlag)
+}
+
+func (ctx ContextWrapper) ListenFlag() string {
+	return ctx.String(ListenFlag)
+}
+
+func (ctx ContextWrapper) IgnoreFlag() []string {
+	return ctx.StringSlice(IgnoreFlag)
+}
+
+func (ctx ContextWrapper) UpdateSnapshotsFlag() bool {
+	return ctx.Bool(UpdateSnapshotsFlag)
+}
+
+func (ctx ContextWrapper) EnvFlag() string {
+	return ctx.String(EnvFlag)
+}
+
+func (ctx ContextWrapper) OutputFlag() string {
+	return ctx.String(OutputFlag)
+}
@@ -1,29 +1,49 @@
 package config
 
 import (
+	"fmt"
 	"github.com/ghodss/yaml"
 	"github.com/pkg/errors"
-	"os"
+	"github.com/res-am/grpc-fts/internal/models"
+	"strings"
 )
 
 type Global struct {
 	ProtoRoot    string   `json:"proto_root"`
 	ProtoImports []string `json:"proto_imports"`
 	ProtoSources []string `json:"proto_sources"`
-	Format       string   `json:"format"`
-	Timestamp    bool     `json:"timestamp"`
+	// ProtoDescriptorSets are paths to binary FileDescriptorSets or Buf images
+	ProtoDescriptorSets []string `json:"proto_descriptor_sets"`
+	Descriptors         string   `json:"descriptors"`
+	Format              string   `json:"format"`
+	Timestamp           bool     `json:"timestamp"`
+	// Setup steps are run once before all test cases, Teardown steps are run once after them
+	Setup    []Step
+	Teardown []Step
 }
 
-func NewGlobal(ctx ContextWrapper) (*Global, error) {
-	file, err := os.ReadFile(ctx.ConfigFlag() + "/global.yaml")
+func NewGlobal(ctx ContextWrapper, services Services) (*Global, error) {
+	file, origins, err := ReadLayered(ctx, "global")
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading service config")
+		return nil, errors.Wrap(err, "global config")
 	}
 
 	var config Global
 	err = yaml.Unmarshal(file, &config)
 	if err != nil {
-		return nil, errors.Wrap(err, "error parsing service config")
+		files := strings.Join(LayerFiles(ctx, "global"), ", ")
+
+		return nil, models.NewErr(fmt.Sprintf("error parsing %s: %s", files, err.Error()))
+	}
+
+	if err := config.setPositions(ctx.ConfigFlag(), origins); err != nil {
+		return nil, errors.Wrap(err, "error reading positions of global steps")
+	}
+
+	for _, steps := range [][]Step{config.Setup, config.Teardown} {
+		if err := bindServices(steps, services); err != nil {
+			return nil, errors.Wrap(err, "global.yaml")
+		}
 	}
 
 	return &config, nil
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// layeredConfigs are config files which can be layered for environments
+var layeredConfigs = []string{"services", "variables", "global"}
+
+// Origins maps paths of effective values, like "foo.metadata.token", to files they came from
+type Origins map[string]string
+
+// ReadLayered reads the config file, like services.yaml, and deep merges the layer of the environment over it,
+// like services.staging.yaml. Objects are merged by keys, other values of the layer replace the base ones.
+// Result is JSON, so it's parsed as YAML. Error matches os.ErrNotExist if there are no files of the config,
+// invalid YAML of a file is a user error.
+func ReadLayered(ctx ContextWrapper, name string) ([]byte, Origins, error) {
+	files := LayerFiles(ctx, name)
+
+	var merged any
+	origins := make(Origins)
+	found := false
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.Join(ctx.ConfigFlag(), file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "error reading %s", file)
+		}
+		found = true
+
+		layer, err := parseLayer(content)
+		if err != nil {
+			return nil, nil, models.NewErr(fmt.Sprintf("error parsing %s: %s", file, err.Error()))
+		}
+		merged = mergeLayer("", merged, layer, file, origins)
+	}
+
+	if !found {
+		return nil, nil, errors.Wrapf(os.ErrNotExist, "%s not found", strings.Join(files, ", "))
+	}
+
+	content, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error merging %s", strings.Join(files, ", "))
+	}
+
+	return content, origins, nil
+}
+
+// LayerFiles returns names of files of the config, like services.yaml and services.staging.yaml,
+// the base file goes first
+func LayerFiles(ctx ContextWrapper, name string) []string {
+	files := []string{name + ".yaml"}
+	if env := ctx.EnvFlag(); env != "" {
+		files = append(files, name+"."+env+".yaml")
+	}
+
+	return files
+}
+
+// parseLayer parses YAML keeping numbers as is, so big integers don't lose precision
+func parseLayer(content []byte) (any, error) {
+	converted, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return nil, err
+	}
+
+	var layer any
+	decoder := json.NewDecoder(bytes.NewReader(converted))
+	decoder.UseNumber()
+	if err := decoder.Decode(&layer); err != nil {
+		return nil, err
+	}
+
+	return layer, nil
+}
+
+// LayeredOrigins returns origins of effective values of all layered configs by their names
+func LayeredOrigins(ctx ContextWrapper) (map[string]Origins, error) {
+	result := make(map[string]Origins, len(layeredConfigs))
+	for _, name := range layeredConfigs {
+		_, origins, err := ReadLayered(ctx, name)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result[name] = origins
+	}
+
+	return result, nil
+}
+
+// Paths returns paths of values in order
+func (o Origins) Paths() []string {
+	paths := make([]string, 0, len(o))
+	for path := range o {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// mergeLayer merges the layer over the base value, keys of objects are matched case-insensitively
+// the same way as they're matched on parsing
+func mergeLayer(path string, base, layer any, file string, origins Origins) any {
+	layerObject, isLayerObject := layer.(map[string]any)
+	baseObject, isBaseObject := base.(map[string]any)
+	if !isLayerObject || !isBaseObject {
+		// replaced value is removed with all of its nested values
+		for existing := range origins {
+			if existing == path || strings.HasPrefix(existing, path+".") || path == "" {
+				delete(origins, existing)
+			}
+		}
+		setOrigins(path, layer, file, origins)
+
+		return layer
+	}
+
+	for key, value := range layerObject {
+		baseKey := key
+		for existing := range baseObject {
+			if strings.EqualFold(existing, key) {
+				baseKey = existing
+
+				break
+			}
+		}
+
+		baseObject[baseKey] = mergeLayer(joinPath(path, baseKey), baseObject[baseKey], value, file, origins)
+	}
+
+	return baseObject
+}
+
+func setOrigins(path string, value any, file string, origins Origins) {
+	if object, ok := value.(map[string]any); ok && len(object) > 0 {
+		for key, item := range object {
+			setOrigins(joinPath(path, key), item, file, origins)
+		}
+
+		return
+	}
+
+	if path != "" {
+		origins[path] = file
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"fmt"
+	"github.com/res-am/grpc-fts/internal/models"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Positions are positions of yaml nodes of the step by their paths, like response.items[0].id.
+// The step itself has empty path, its keys are lowercased the same way as they're matched on parsing.
+type Positions map[string]models.Position
+
+// Find returns position of the path, or of its closest parent if the path has no node,
+// like a field under the function which checks it
+func (p Positions) Find(path string) models.Position {
+	for {
+		if position, ok := p[path]; ok {
+			return position
+		}
+		if path == "" {
+			return models.Position{}
+		}
+
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			i = 0
+		}
+		path = path[:i]
+	}
+}
+
+// readDocument parses the yaml file keeping positions of its nodes, nil is returned for empty file
+func readDocument(path string, content []byte) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, models.NewErr(fmt.Sprintf("error parsing %s: %s", path, err.Error()))
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+
+	return document.Content[0], nil
+}
+
+// setPositions sets positions of the test case, its steps and examples from the root node of its file
+func (t *TestCase) setPositions(file string, root *yaml.Node) {
+	t.Position = models.Position{File: file, Line: 1, Column: 1}
+	if root == nil {
+		return
+	}
+
+	t.Position = nodePosition(file, root)
+	setStepsPositions(file, mappingValue(root, "setup"), t.Setup)
+	setStepsPositions(file, mappingValue(root, "steps"), t.Steps)
+	setStepsPositions(file, mappingValue(root, "teardown"), t.Teardown)
+
+	dependsOn := mappingValue(root, "depends_on")
+	if dependsOn != nil && dependsOn.Kind == yaml.SequenceNode {
+		t.dependencies = make(map[string]models.Position, len(dependsOn.Content))
+		for _, item := range dependsOn.Content {
+			t.dependencies[item.Value] = nodePosition(file, item)
+		}
+	}
+
+	examples := mappingValue(root, "examples")
+	if examples != nil && examples.Kind == yaml.SequenceNode {
+		for i := range t.Examples {
+			if i < len(examples.Content) {
+				t.Examples[i].Position = nodePosition(file, examples.Content[i])
+			}
+		}
+	}
+}
+
+// setPositions sets positions of global steps from the file which defines them, with environment layer
+// it's the layer if it replaces the steps
+func (g *Global) setPositions(configDir string, origins Origins) error {
+	for key, steps := range map[string][]Step{"setup": g.Setup, "teardown": g.Teardown} {
+		origin := ""
+		for path, file := range origins {
+			if strings.EqualFold(path, key) {
+				origin = file
+			}
+		}
+		if origin == "" || len(steps) == 0 {
+			continue
+		}
+
+		path := filepath.Join(configDir, origin)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		root, err := readDocument(path, content)
+		if err != nil {
+			return err
+		}
+		if root != nil {
+			setStepsPositions(path, mappingValue(root, key), steps)
+		}
+	}
+
+	return nil
+}
+
+// setPositions sets positions of services and their keys, like metadata.authorization, from the files which define them.
+// Keys of the environment layer override the base ones.
+func (s Services) setPositions(configDir string, origins Origins) error {
+	files := make([]string, 0, 2)
+	for _, file := range origins {
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	// the base file, like services.yaml, is shorter than its layers
+	sort.Slice(files, func(i, j int) bool { return len(files[i]) < len(files[j]) })
+
+	for _, file := range files {
+		path := filepath.Join(configDir, file)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		root, err := readDocument(path, content)
+		if err != nil {
+			return err
+		}
+		if root == nil || root.Kind != yaml.MappingNode {
+			continue
+		}
+
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			service, ok := s[root.Content[i].Value]
+			if !ok {
+				continue
+			}
+			if service.Positions == nil {
+				service.Positions = make(Positions)
+			}
+
+			collectPositions(path, "", nodePosition(path, root.Content[i]), root.Content[i+1], service.Positions)
+			s[root.Content[i].Value] = service
+		}
+	}
+
+	return nil
+}
+
+func setStepsPositions(file string, node *yaml.Node, steps []Step) {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for i := range steps {
+		if i >= len(node.Content) {
+			return
+		}
+
+		steps[i].Positions = make(Positions)
+		collectPositions(file, "", nodePosition(file, node.Content[i]), node.Content[i], steps[i].Positions)
+	}
+}
+
+// collectPositions adds positions of the node and its children under the path, values of mappings
+// are positioned at their keys
+func collectPositions(file, path string, position models.Position, node *yaml.Node, positions Positions) {
+	positions[path] = position
+	switch node.Kind { //nolint:exhaustive
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path == "" {
+				key = strings.ToLower(key)
+			}
+
+			collectPositions(file, joinPath(path, key), nodePosition(file, node.Content[i]), node.Content[i+1], positions)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			collectPositions(file, fmt.Sprintf("%s[%d]", path, i), nodePosition(file, item), item, positions)
+		}
+	}
+}
+
+func nodePosition(file string, node *yaml.Node) models.Position {
+	return models.Position{File: file, Line: node.Line, Column: node.Column}
+}
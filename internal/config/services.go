@@ -6,6 +6,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/res-am/grpc-fts/internal/models"
 	"os"
+	"strings"
 )
 
 type Services map[string]Service
@@ -15,21 +16,31 @@ type Service struct {
 	Service  string
 	TLS      *models.TLS
 	Metadata Metadata
+	// Descriptors is the way to resolve method descriptors: local (default) or reflection
+	Descriptors string
+	// Positions are locations of the service and its keys in services.yaml
+	Positions Positions `json:"-"`
 }
 
 func NewServices(ctx ContextWrapper) (Services, error) {
-	file, err := os.ReadFile(ctx.ConfigFlag() + "/services.yaml")
+	file, origins, err := ReadLayered(ctx, "services")
 	if errors.Is(err, os.ErrNotExist) {
 		return nil, models.NewErr("services.yaml file not found")
 	}
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading service config")
+		return nil, errors.Wrap(err, "service config")
 	}
 
 	var config Services
 	err = yaml.Unmarshal(file, &config)
 	if err != nil {
-		return nil, models.NewErr(fmt.Sprintf("error parsing service config: %s", err.Error()))
+		files := strings.Join(LayerFiles(ctx, "services"), ", ")
+
+		return nil, models.NewErr(fmt.Sprintf("error parsing %s: %s", files, err.Error()))
+	}
+
+	if err := config.setPositions(ctx.ConfigFlag(), origins); err != nil {
+		return nil, errors.Wrap(err, "error reading positions of services")
 	}
 
 	return config, nil
@@ -19,7 +19,7 @@ func TestNewServices_NoFile(t *testing.T) {
 	}
 
 	ctx := cli.NewContext(nil, flagSet, nil)
-	_, err = config.NewServices(ctx)
+	_, err = config.NewServices(config.NewContextWrapper(ctx))
 
 	assert.ErrorAs(t, err, &models.UserErr{})
 }
@@ -39,9 +39,10 @@ func TestNewServices_InvalidFile(t *testing.T) {
 	}
 
 	ctx := cli.NewContext(nil, flagSet, nil)
-	_, err = config.NewServices(ctx)
+	_, err = config.NewServices(config.NewContextWrapper(ctx))
 
-	assert.ErrorContains(t, err, "error parsing service config")
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.ErrorContains(t, err, "error parsing services.yaml")
 }
 
 func TestNewServices_Positive(t *testing.T) {
@@ -65,7 +66,7 @@ foo:
 	}
 
 	ctx := cli.NewContext(nil, flagSet, nil)
-	services, err := config.NewServices(ctx)
+	services, err := config.NewServices(config.NewContextWrapper(ctx))
 
 	assert.NoError(t, err)
 	assert.Contains(t, services, "foo")
@@ -74,3 +75,71 @@ foo:
 	assert.Contains(t, services["foo"].Metadata, "bar")
 	assert.Equal(t, services["foo"].Metadata["bar"], "123")
 }
+
+func TestNewServices_Env(t *testing.T) {
+	dir := t.TempDir()
+	base := `
+foo:
+  address: localhost:8080
+  service: foo.Service
+  metadata:
+    x-client: fts
+    authorization: local
+`
+	layer := `
+foo:
+  Address: foo.staging:443
+  metadata:
+    authorization: staging
+`
+	assert.NoError(t, os.WriteFile(dir+"/services.yaml", []byte(base), 0o600))
+	assert.NoError(t, os.WriteFile(dir+"/services.staging.yaml", []byte(layer), 0o600))
+
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.String("configs", dir, "path to configs directory")
+	flagSet.String("env", "staging", "environment")
+	ctx := config.NewContextWrapper(cli.NewContext(nil, flagSet, nil))
+
+	services, err := config.NewServices(ctx)
+
+	assert.NoError(t, err)
+	service := services["foo"]
+	assert.Equal(t, models.Position{File: dir + "/services.yaml", Line: 6, Column: 5}, service.Positions.Find("metadata.x-client"))
+	assert.Equal(t, models.Position{File: dir + "/services.staging.yaml", Line: 5, Column: 5}, service.Positions.Find("metadata.authorization"))
+	service.Positions = nil
+	assert.Equal(t, config.Service{
+		Address:  "foo.staging:443",
+		Service:  "foo.Service",
+		Metadata: config.Metadata{"x-client": "fts", "authorization": "staging"},
+	}, service)
+
+	origins, err := config.LayeredOrigins(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, config.Origins{
+		"foo.address":                "services.staging.yaml",
+		"foo.service":                "services.yaml",
+		"foo.metadata.x-client":      "services.yaml",
+		"foo.metadata.authorization": "services.staging.yaml",
+	}, origins["services"])
+}
+
+func TestNewServices_EnvErrors(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(dir+"/services.yaml", []byte("foo:\n  service: foo.Service\n"), 0o600))
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.String("configs", dir, "path to configs directory")
+	flagSet.String("env", "staging", "environment")
+	ctx := config.NewContextWrapper(cli.NewContext(nil, flagSet, nil))
+
+	assert.NoError(t, os.WriteFile(dir+"/services.staging.yaml", []byte("foo: [unclosed"), 0o600))
+	_, err := config.NewServices(ctx)
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.ErrorContains(t, err, "error parsing services.staging.yaml")
+
+	assert.NoError(t, os.Remove(dir+"/services.staging.yaml"))
+	assert.NoError(t, os.Mkdir(dir+"/services.staging.yaml", os.ModePerm))
+	_, err = config.NewServices(ctx)
+	assert.ErrorContains(t, err, "error reading services.staging.yaml")
+	assert.NotErrorIs(t, err, os.ErrNotExist)
+}
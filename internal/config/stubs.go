@@ -0,0 +1,86 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/models"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"os"
+)
+
+type Stubs []Stub
+
+// Stub is a canned response of the mock server for calls which match the request and metadata
+type Stub struct {
+	ServiceName string `json:"service"`
+	Method      string
+	// Request and Metadata are matchers with the same functions as response expectations,
+	// messages of client streaming calls are matched as `stream` array
+	Request  json.RawMessage
+	Metadata json.RawMessage
+	Response json.RawMessage
+	// Stream is a sequence of messages for server streaming methods
+	Stream []json.RawMessage
+	Status *StubStatus
+	// Latency delays the response and each message of the stream
+	Latency Duration
+	Service Service `json:"-"`
+	// Source is file and position of the stub, it's used in logs
+	Source string `json:"-"`
+}
+
+func (s Stub) BuildProtoFullName() protoreflect.FullName {
+	return protoreflect.FullName(fmt.Sprintf("%s.%s", s.Service.Service, s.Method))
+}
+
+type StubStatus struct {
+	Code    string
+	Message string
+	// Details are google.rpc.Status details in json format, each one has @type key with type url
+	Details []json.RawMessage
+}
+
+func NewStubs(ctx ContextWrapper, services Services) (Stubs, error) {
+	dir := ctx.ConfigFlag() + "/stubs"
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, models.NewErr("stubs directory not found")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "error on reading stubs dir")
+	}
+
+	stubs := make(Stubs, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		filePath := dir + "/" + file.Name()
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", filePath)
+		}
+
+		var fileStubs Stubs
+		err = yaml.Unmarshal(content, &fileStubs)
+		if err != nil {
+			return nil, models.NewErr(fmt.Sprintf("error parsing %s: %s", filePath, err.Error()))
+		}
+
+		for i := range fileStubs {
+			service, exists := services[fileStubs[i].ServiceName]
+			if !exists {
+				return nil, models.NewErr("service '" + fileStubs[i].ServiceName + "' not found")
+			}
+
+			fileStubs[i].Service = service
+			fileStubs[i].Source = fmt.Sprintf("%s#%d", file.Name(), i+1)
+		}
+		stubs = append(stubs, fileStubs...)
+	}
+
+	return stubs, nil
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/models"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+)
+
+// TestCaseFile is a test case file which can be rewritten, comments and order of keys
+// are kept for all nodes except the rewritten ones
+type TestCaseFile struct {
+	path string
+	root yaml.Node
+}
+
+func ReadTestCaseFile(path string) (*TestCaseFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+
+	file := &TestCaseFile{path: path}
+	if err := yaml.Unmarshal(content, &file.root); err != nil {
+		return nil, models.NewErr(fmt.Sprintf("error parsing %s: %s", path, err.Error()))
+	}
+
+	return file, nil
+}
+
+// SetStepField replaces value of the step field, nil value removes the field
+func (f *TestCaseFile) SetStepField(step int, key string, value any) error {
+	if len(f.root.Content) == 0 {
+		return models.NewErr(fmt.Sprintf("%s is empty", f.path))
+	}
+
+	steps := mappingValue(f.root.Content[0], "steps")
+	if steps == nil || steps.Kind != yaml.SequenceNode || len(steps.Content) <= step {
+		return models.NewErr(fmt.Sprintf("step %d not found in %s", step+1, f.path))
+	}
+
+	stepNode := steps.Content[step]
+	if stepNode.Kind != yaml.MappingNode {
+		return models.NewErr(fmt.Sprintf("step %d of %s is not an object", step+1, f.path))
+	}
+
+	index := mappingIndex(stepNode, key)
+	if value == nil {
+		if index >= 0 {
+			stepNode.Content = append(stepNode.Content[:index], stepNode.Content[index+2:]...)
+		}
+
+		return nil
+	}
+
+	valueNode := new(yaml.Node)
+	if err := valueNode.Encode(value); err != nil {
+		return errors.Wrapf(err, "error encoding %s of step %d", key, step+1)
+	}
+
+	if index >= 0 {
+		stepNode.Content[index+1] = valueNode
+	} else {
+		stepNode.Content = append(stepNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode)
+	}
+
+	return nil
+}
+
+func (f *TestCaseFile) Write() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return errors.Wrapf(err, "error reading %s", f.path)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&f.root); err != nil {
+		return errors.Wrapf(err, "error encoding %s", f.path)
+	}
+	if err := encoder.Close(); err != nil {
+		return errors.Wrapf(err, "error encoding %s", f.path)
+	}
+
+	if err := os.WriteFile(f.path, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return errors.Wrapf(err, "error writing %s", f.path)
+	}
+
+	return nil
+}
+
+// mappingIndex returns index of the key node in the mapping, keys are matched case-insensitively
+// the same way as they're matched on parsing
+func mappingIndex(node *yaml.Node, key string) int {
+	if node.Kind != yaml.MappingNode {
+		return -1
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	index := mappingIndex(node, key)
+	if index < 0 {
+		return nil
+	}
+
+	return node.Content[index+1]
+}
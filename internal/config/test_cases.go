@@ -8,16 +8,44 @@ import (
 	"github.com/res-am/grpc-fts/internal/models"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 type TestCases []TestCase
 
 type TestCase struct {
+	// Setup steps are run before steps, Teardown steps are run at the end regardless of the result
+	Setup     []Step
 	Steps     []Step
+	Teardown  []Step
 	DependsOn []string `json:"depends_on"`
 	Name      string
+	// Outputs are stored values shared with dependent test cases, they're referenced like ${name.output}
+	Outputs []string
+	// Examples expand the test case into instances, one per example, with their own variables
+	Examples []Example
+	// File is a path of the test case file
+	File string `json:"-"`
+	// Group is the name of the parameterized test case, it's set only for its instances
+	Group string `json:"-"`
+	// Variables are bindings of the example, they're set only for instances of parameterized test case
+	Variables map[string]any `json:"-"`
+	// Position is a location of the test case in its file, or of the example for instances
+	Position models.Position `json:"-"`
+	// dependencies are locations of items of depends_on by their names
+	dependencies map[string]models.Position
+}
+
+// Example is a named set of variables for an instance of parameterized test case
+type Example struct {
+	Name      string
+	Variables map[string]any
+	Position  models.Position `json:"-"`
 }
 
 type Function string
@@ -27,32 +55,94 @@ type Step struct {
 	Method      string
 	Request     json.RawMessage
 	Response    json.RawMessage
+	Headers     json.RawMessage
+	Trailers    json.RawMessage
 	Status      *Status
 	Metadata    Metadata
 	Store       map[string]interface{}
 	Stream      bool
-	Service     Service `json:"-"`
+	Retry       *Retry
+	Snapshot    *Snapshot
+	// SendDelay is a pause before each message of client stream except the first one
+	SendDelay Duration `json:"send_delay"`
+	// Conversation replaces request and response of bidirectional streams, entries are run in order
+	Conversation []ConversationEntry
+	Service      Service `json:"-"`
+	// Positions are locations of the step and its nested keys in the config file
+	Positions Positions `json:"-"`
+}
+
+// Position returns location of the step in the config file
+func (s Step) Position() models.Position {
+	return s.Positions.Find("")
 }
 
 func (s Step) BuildProtoFullName() protoreflect.FullName {
 	return protoreflect.FullName(fmt.Sprintf("%s.%s", s.Service.Service, s.Method))
 }
 
+// ConversationEntry is either a message sent to the stream, an expectation of the next received message
+// or a marker. HalfClose closes the sending side of the stream, ExpectClose expects the stream to be finished
+// with the status of the step.
+type ConversationEntry struct {
+	Send        json.RawMessage
+	Expect      json.RawMessage
+	HalfClose   bool `json:"half_close"`
+	ExpectClose bool `json:"expect_close"`
+	// Timeout limits waiting for the expected message or the end of the stream
+	Timeout Duration
+}
+
+// Retry describes how the step is re-invoked until its expectations pass
+type Retry struct {
+	Attempts int
+	Interval Duration
+	// Backoff is a multiplier of interval for each next attempt
+	Backoff float64
+	Timeout Duration
+	// OnCodes limits retries to specific status codes of the response
+	OnCodes []string `json:"on_codes"`
+}
+
+// Snapshot compares the full response with the stored golden file, it's written as `snapshot: true`
+// or as an object with ignored and redacted fields
+type Snapshot struct {
+	Enabled bool `json:"-"`
+	// Ignore fields are neither stored nor compared
+	Ignore []string
+	// Redact fields are stored with a placeholder, so only their presence is compared
+	Redact []string
+}
+
+func (s *Snapshot) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &s.Enabled); err == nil {
+		return nil
+	}
+
+	type snapshot Snapshot
+	if err := json.Unmarshal(b, (*snapshot)(s)); err != nil {
+		return errors.Wrap(err, "boolean or object with ignore and redact fields was expected")
+	}
+	s.Enabled = true
+
+	return nil
+}
+
+// Status fields are either exact values or expectations with functions, like one_of or not
 type Status struct {
-	Code    *string
-	Message *string
+	Code    any
+	Message any
+	// Details are decoded google.rpc.Status details, each one has @type key with type url
+	Details any
 }
 
 func NewTestCases(ctx ContextWrapper, logger *logrus.Entry, services Services) (TestCases, error) {
-	files, err := os.ReadDir(ctx.ConfigFlag() + "/test-cases")
+	testCases, err := readTestCases(ctx, logger, services)
 	if err != nil {
-		logger.Errorf("error on reading test-cases dir: %s", err)
-
-		return nil, errors.Wrap(err, "error on reading test-cases dir")
+		return nil, err
 	}
 
-	testCases, err := collectTestCases(ctx.ConfigFlag(), files, services)
-	if err != nil {
+	if err := testCases.checkDependencies(); err != nil {
 		return nil, err
 	}
 
@@ -71,6 +161,42 @@ func NewTestCases(ctx ContextWrapper, logger *logrus.Entry, services Services) (
 	return testCases, nil
 }
 
+// NewValidatedTestCases reads all test cases for the validate command. Unknown dependencies are kept,
+// so they're reported by the validator together with other problems
+func NewValidatedTestCases(ctx ContextWrapper, logger *logrus.Entry, services Services) (TestCases, error) {
+	testCases, err := readTestCases(ctx, logger, services)
+	if err != nil {
+		return nil, err
+	}
+
+	names := testCases.names()
+	known := make(TestCases, 0, len(testCases))
+	for _, testCase := range testCases {
+		testCase.DependsOn = slices.DeleteFunc(slices.Clone(testCase.DependsOn), func(name string) bool {
+			_, ok := names[name]
+
+			return !ok
+		})
+		known = append(known, testCase)
+	}
+	if _, err := Sort(known); err != nil {
+		return nil, errors.Wrapf(err, "test case dependency error")
+	}
+
+	return testCases, nil
+}
+
+func readTestCases(ctx ContextWrapper, logger *logrus.Entry, services Services) (TestCases, error) {
+	files, err := os.ReadDir(ctx.ConfigFlag() + "/test-cases")
+	if err != nil {
+		logger.Errorf("error on reading test-cases dir: %s", err)
+
+		return nil, errors.Wrap(err, "error on reading test-cases dir")
+	}
+
+	return collectTestCases(ctx.ConfigFlag(), files, services)
+}
+
 func collectTestCases(configDir string, files []os.DirEntry, services Services) (TestCases, error) {
 	testCases := make(TestCases, 0, len(files))
 	for _, file := range files {
@@ -89,41 +215,222 @@ func collectTestCases(configDir string, files []os.DirEntry, services Services)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error parsing %s", filePath)
 		}
+		root, err := readDocument(filePath, content)
+		if err != nil {
+			return nil, err
+		}
+		testCase.setPositions(filepath.Clean(filePath), root)
 
-		for i := range testCase.Steps {
-			service, exists := services[testCase.Steps[i].ServiceName]
-			if !exists {
-				return nil, models.NewErr("service '" + testCase.Steps[i].ServiceName + "' not found")
+		for _, steps := range [][]Step{testCase.Setup, testCase.Steps, testCase.Teardown} {
+			if err := bindServices(steps, services); err != nil {
+				return nil, err
 			}
-
-			testCase.Steps[i].Service = service
 		}
 
+		testCase.File = filePath
 		if testCase.Name == "" {
 			fileName := file.Name()
 			testCase.Name = fileName[:len(fileName)-len(filepath.Ext(fileName))]
 		}
-		testCases = append(testCases, testCase)
+
+		instances, err := testCase.expand()
+		if err != nil {
+			return nil, err
+		}
+		testCases = append(testCases, instances...)
 	}
 
-	return testCases, nil
+	return testCases.resolveGroups(), nil
 }
 
-func (t TestCases) Filter(target string) (TestCases, error) {
-	var targetTestCase TestCase
+// expand returns instances of the test case, one per example, named like "name[example]".
+// Test case without examples is returned as is.
+func (t TestCase) expand() (TestCases, error) {
+	if len(t.Examples) == 0 {
+		return TestCases{t}, nil
+	}
+
+	// references like ${create[1].id} already index stored arrays, so outputs of instances can't be referenced
+	if len(t.Outputs) > 0 {
+		problem := fmt.Sprintf("test case %s with examples can't have outputs", t.Name)
+		if t.Position.IsKnown() {
+			problem = t.Position.String() + ": " + problem
+		}
+
+		return nil, models.NewErr(problem)
+	}
+
+	result := make(TestCases, 0, len(t.Examples))
+	names := make(map[string]struct{}, len(t.Examples))
+	for i, example := range t.Examples {
+		name := example.Name
+		if name == "" {
+			name = strconv.Itoa(i + 1)
+		}
+		if _, ok := names[name]; ok {
+			return nil, models.NewErr(fmt.Sprintf("duplicate example %s of test case %s", name, t.Name))
+		}
+		names[name] = struct{}{}
+
+		instance := t
+		instance.Setup = copySteps(t.Setup)
+		instance.Steps = copySteps(t.Steps)
+		instance.Teardown = copySteps(t.Teardown)
+		instance.Name = fmt.Sprintf("%s[%s]", t.Name, name)
+		instance.Group = t.Name
+		instance.Variables = example.Variables
+		instance.Examples = nil
+		if example.Position.IsKnown() {
+			instance.Position = example.Position
+		}
+		result = append(result, instance)
+	}
+
+	return result, nil
+}
+
+// copySteps returns a copy of the steps with their own metadata, so instances of test cases don't share
+// values which are changed during the run
+func copySteps(steps []Step) []Step {
+	if steps == nil {
+		return nil
+	}
+
+	result := make([]Step, len(steps))
+	for i, step := range steps {
+		step.Metadata = maps.Clone(step.Metadata)
+		step.Store = maps.Clone(step.Store)
+		result[i] = step
+	}
+
+	return result
+}
+
+// resolveGroups replaces dependencies on parameterized test cases with dependencies on all of their instances
+func (t TestCases) resolveGroups() TestCases {
+	groups := make(map[string][]string)
+	for _, testCase := range t {
+		if testCase.Group != "" {
+			groups[testCase.Group] = append(groups[testCase.Group], testCase.Name)
+		}
+	}
+	if len(groups) == 0 {
+		return t
+	}
+
+	for i := range t {
+		dependsOn := make([]string, 0, len(t[i].DependsOn))
+		for _, dependency := range t[i].DependsOn {
+			if instances, ok := groups[dependency]; ok {
+				dependsOn = append(dependsOn, instances...)
+			} else {
+				dependsOn = append(dependsOn, dependency)
+			}
+		}
+		t[i].DependsOn = dependsOn
+	}
+
+	return t
+}
+
+// checkDependencies reports all dependencies on test cases which don't exist
+// DependencyProblem is a dependency on a test case which doesn't exist
+type DependencyProblem struct {
+	// Position is the position of the dependency, or of the test case if it's unknown
+	Position   models.Position
+	TestCase   string
+	Dependency string
+}
+
+func (p DependencyProblem) Error() string {
+	return fmt.Sprintf("test case %s depends on unknown test case %s", p.TestCase, p.Dependency)
+}
+
+// UnknownDependencies returns dependencies on test cases which don't exist
+func (t TestCases) UnknownDependencies() []DependencyProblem {
+	names := t.names()
+
+	var problems []DependencyProblem
 	for _, testCase := range t {
-		if testCase.Name == target {
-			targetTestCase = testCase
+		for _, dependency := range testCase.DependsOn {
+			if _, ok := names[dependency]; ok {
+				continue
+			}
 
-			break
+			position, ok := testCase.dependencies[dependency]
+			if !ok {
+				position = testCase.Position
+			}
+			problems = append(problems, DependencyProblem{Position: position, TestCase: testCase.Name, Dependency: dependency})
+		}
+	}
+
+	return problems
+}
+
+func (t TestCases) checkDependencies() error {
+	var problems []string
+	for _, problem := range t.UnknownDependencies() {
+		message := problem.Error()
+		if problem.Position.IsKnown() {
+			message = problem.Position.String() + ": " + message
+		}
+		problems = append(problems, message)
+	}
+	if len(problems) > 0 {
+		return models.NewErr(strings.Join(problems, "\n"))
+	}
+
+	return nil
+}
+
+func (t TestCases) names() map[string]struct{} {
+	names := make(map[string]struct{}, len(t))
+	for _, testCase := range t {
+		names[testCase.Name] = struct{}{}
+	}
+
+	return names
+}
+
+// AllSteps returns setup steps, steps and teardown steps in order of their run
+func (t TestCase) AllSteps() []Step {
+	steps := make([]Step, 0, len(t.Setup)+len(t.Steps)+len(t.Teardown))
+	steps = append(steps, t.Setup...)
+	steps = append(steps, t.Steps...)
+
+	return append(steps, t.Teardown...)
+}
+
+func bindServices(steps []Step, services Services) error {
+	for i := range steps {
+		service, exists := services[steps[i].ServiceName]
+		if !exists {
+			return models.NewErr("service '" + steps[i].ServiceName + "' not found")
+		}
+
+		steps[i].Service = service
+	}
+
+	return nil
+}
+
+// Filter returns the target test case with its dependencies, target can be a parameterized test case
+// to run all of its instances or a single instance
+func (t TestCases) Filter(target string) (TestCases, error) {
+	result := make(TestCases, 0)
+	for _, testCase := range t {
+		if testCase.Name == target || testCase.Group == target {
+			result = append(result, t.CollectDependencies(testCase)...)
+			result = append(result, testCase)
 		}
 	}
 
-	if targetTestCase.Name == "" {
+	if len(result) == 0 {
 		return nil, errors.New("target test case not found")
 	}
 
-	return append(t.CollectDependencies(targetTestCase), targetTestCase), nil
+	return result, nil
 }
 
 func (t TestCases) CollectDependencies(target TestCase) TestCases {
@@ -0,0 +1,147 @@
+package config_test
+
+import (
+	"flag"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const parameterizedTestCase = `
+name: create
+examples:
+  - name: admin
+    variables:
+      role: admin
+  - variables:
+      role: viewer
+steps:
+  - service: users
+    method: Create
+    request:
+      role: $role
+`
+
+func TestNewTestCases_ExamplesWithOutputs(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), os.ModePerm))
+	testCase := "outputs: [id]\n" + parameterizedTestCase
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "create.yaml"), []byte(testCase), 0o600))
+	services := config.Services{"users": config.Service{Service: "test.Users"}}
+
+	_, err := config.NewTestCases(newContext(t, dir, ""), logrus.NewEntry(logrus.New()), services)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.ErrorContains(t, err, "create.yaml:1:1: test case create with examples can't have outputs")
+}
+
+func TestNewTestCases_Examples(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "create.yaml"), []byte(parameterizedTestCase), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "list.yaml"), []byte("depends_on: [create]"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "get.yaml"), []byte("depends_on:\n  - create[admin]"), 0o600))
+	services := config.Services{"users": config.Service{Service: "test.Users"}}
+
+	testCases, err := config.NewTestCases(newContext(t, dir, ""), logrus.NewEntry(logrus.New()), services)
+
+	assert.NoError(t, err)
+	byName := make(map[string]config.TestCase, len(testCases))
+	for _, testCase := range testCases {
+		byName[testCase.Name] = testCase
+	}
+	if assert.Len(t, byName, 4) {
+		assert.Equal(t, map[string]any{"role": "admin"}, byName["create[admin]"].Variables)
+		assert.Equal(t, map[string]any{"role": "viewer"}, byName["create[2]"].Variables)
+		assert.Equal(t, "create", byName["create[2]"].Group)
+		assert.ElementsMatch(t, []string{"create[admin]", "create[2]"}, byName["list"].DependsOn)
+		assert.Equal(t, []string{"create[admin]"}, byName["get"].DependsOn)
+	}
+
+	testCases, err = config.NewTestCases(newContext(t, dir, "get"), logrus.NewEntry(logrus.New()), services)
+
+	assert.NoError(t, err)
+	names := make([]string, 0, len(testCases))
+	for _, testCase := range testCases {
+		names = append(names, testCase.Name)
+	}
+	assert.Equal(t, []string{"create[admin]", "get"}, names)
+}
+
+func TestNewTestCases_UnknownDependencies(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "list.yaml"), []byte("depends_on: [create, init]"), 0o600))
+
+	_, err := config.NewTestCases(newContext(t, dir, ""), logrus.NewEntry(logrus.New()), config.Services{})
+
+	file := filepath.Join(dir, "test-cases", "list.yaml")
+	assert.EqualError(t, err, file+":1:14: test case list depends on unknown test case create\n"+
+		file+":1:22: test case list depends on unknown test case init")
+}
+
+func TestNewValidatedTestCases_UnknownDependencies(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "init.yaml"), []byte("steps: []"), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "list.yaml"), []byte("depends_on: [create, init]"), 0o600))
+
+	testCases, err := config.NewValidatedTestCases(newContext(t, dir, ""), logrus.NewEntry(logrus.New()), config.Services{})
+
+	assert.NoError(t, err)
+	assert.Len(t, testCases, 2)
+	file := filepath.Join(dir, "test-cases", "list.yaml")
+	assert.Equal(t, []config.DependencyProblem{
+		{Position: models.Position{File: file, Line: 1, Column: 14}, TestCase: "list", Dependency: "create"},
+	}, testCases.UnknownDependencies())
+}
+
+const positionedTestCase = `name: get
+steps:
+  - service: users
+    method: Get
+    request:
+      id: 1
+    response:
+      user:
+        id: { gt: 0 }
+        roles: [admin]
+`
+
+func TestNewTestCases_Positions(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "get.yaml"), []byte(positionedTestCase), 0o600))
+	services := config.Services{"users": config.Service{Service: "test.Users"}}
+
+	testCases, err := config.NewTestCases(newContext(t, dir, ""), logrus.NewEntry(logrus.New()), services)
+
+	assert.NoError(t, err)
+	if assert.Len(t, testCases, 1) && assert.Len(t, testCases[0].Steps, 1) {
+		file := filepath.Join(dir, "test-cases", "get.yaml")
+		step := testCases[0].Steps[0]
+		assert.Equal(t, models.Position{File: file, Line: 3, Column: 5}, step.Position())
+		assert.Equal(t, models.Position{File: file, Line: 9, Column: 15}, step.Positions.Find("response.user.id.gt"))
+		assert.Equal(t, models.Position{File: file, Line: 10, Column: 17}, step.Positions.Find("response.user.roles[0]"))
+		assert.Equal(t, models.Position{File: file, Line: 8, Column: 7}, step.Positions.Find("response.user.name"))
+	}
+}
+
+func newContext(t *testing.T, dir, target string) config.ContextWrapper {
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.String("configs", ".", "path to configs directory")
+	flagSet.String("target", "", "target test case")
+	if err := flagSet.Set("configs", dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := flagSet.Set("target", target); err != nil {
+		t.Fatal(err)
+	}
+
+	return config.NewContextWrapper(cli.NewContext(nil, flagSet, nil))
+}
@@ -1,5 +1,11 @@
 package config
 
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"time"
+)
+
 type Metadata map[string]string
 
 func (m Metadata) MergeWith(target map[string]string) map[string]string {
@@ -13,3 +19,21 @@ func (m Metadata) MergeWith(target map[string]string) map[string]string {
 
 	return result
 }
+
+// Duration is parsed from duration string, like "300ms" or "2h45m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return errors.Wrap(err, "duration string was expected")
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return errors.Wrapf(err, "malformed duration %s", value)
+	}
+	*d = Duration(duration)
+
+	return nil
+}
@@ -1,13 +1,19 @@
 package internal
 
 import (
+	"context"
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/res-am/grpc-fts/internal/config"
 	"github.com/res-am/grpc-fts/internal/logic"
 	"github.com/res-am/grpc-fts/internal/models"
 	"github.com/res-am/grpc-fts/internal/proto"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 	"go.uber.org/fx"
+	"net"
+	"os"
+	"sort"
 )
 
 type Container struct {
@@ -20,8 +26,10 @@ func NewContainer(ctx *cli.Context) Container {
 
 func (c Container) RunTestCase() error {
 	return c.runApp(
+		fx.Provide(config.NewTestCases),
+		c.descriptorsManager(proto.NewDescriptorsManager),
 		fx.Invoke(
-			func(variables logic.Variables, services config.Services) error {
+			func(variables *logic.Variables, services config.Services) error {
 				return variables.ReplaceServicesMetadata(services)
 			},
 			func(runner logic.Runner) error {
@@ -33,9 +41,56 @@ func (c Container) RunTestCase() error {
 
 func (c Container) Validate() error {
 	return c.runApp(
-		fx.Invoke(func(validator logic.Validator, testCases config.TestCases) error {
-			return validator.Validate(testCases)
-		}),
+		// unknown dependencies are reported by the validator with other problems
+		fx.Provide(config.NewValidatedTestCases),
+		c.descriptorsManager(proto.NewDescriptorsManager),
+		fx.Invoke(
+			// origins are printed before validating, so they help to find the layer of reported problems
+			func(ctx config.ContextWrapper, logger *logrus.Entry) error {
+				if ctx.EnvFlag() == "" {
+					return nil
+				}
+
+				configs, err := config.LayeredOrigins(ctx)
+				if err != nil {
+					return err
+				}
+				names := make([]string, 0, len(configs))
+				for name := range configs {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+
+				for _, name := range names {
+					origins := configs[name]
+					for _, path := range origins.Paths() {
+						logger.WithField("layer", origins[path]).Infof("%s: %s", name, path)
+					}
+				}
+
+				return nil
+			},
+			// metadata is substituted before descriptors are resolved, so reflection requests are authorized.
+			// metadata which can't be substituted is reported by the validator with its position
+			func(variables *logic.Variables, services config.Services) {
+				_ = variables.ReplaceServicesMetadata(services)
+			},
+			func(validator logic.Validator, testCases config.TestCases, ctx config.ContextWrapper) error {
+				if err := logic.ValidateOutput(ctx.OutputFlag()); err != nil {
+					return err
+				}
+
+				err := validator.Validate(testCases)
+				var problems logic.ValidationErrors
+				if ctx.OutputFlag() == config.GithubOutput && errors.As(err, &problems) {
+					if err := logic.WriteGithubAnnotations(os.Stdout, problems); err != nil {
+						return err
+					}
+				}
+
+				return err
+			},
+		),
 	)
 }
 
@@ -47,19 +102,62 @@ func (c Container) Init() error {
 	)
 }
 
+func (c Container) Record() error {
+	return c.runApp(
+		fx.Provide(config.NewTestCases),
+		c.descriptorsManager(proto.NewDescriptorsManager),
+		fx.Invoke(
+			func(variables *logic.Variables, services config.Services) error {
+				return variables.ReplaceServicesMetadata(services)
+			},
+			func(recorder logic.Recorder) error {
+				return recorder.Record()
+			},
+		),
+	)
+}
+
+func (c Container) Mock() error {
+	return c.runApp(
+		c.descriptorsManager(proto.NewStubsDescriptorsManager),
+		fx.Invoke(func(server logic.MockServer, ctx config.ContextWrapper) error {
+			listener, err := net.Listen("tcp", ctx.ListenFlag())
+			if err != nil {
+				return models.NewErr(fmt.Sprintf("error listening on %s: %s", ctx.ListenFlag(), err.Error()))
+			}
+
+			return server.Serve(c.ctx.Context, listener)
+		}),
+	)
+}
+
+// descriptorsManager provides the descriptors manager, its connections are closed when the app is stopped
+func (c Container) descriptorsManager(constructor any) fx.Option {
+	return fx.Options(
+		fx.Provide(constructor),
+		fx.Decorate(func(lifecycle fx.Lifecycle, manager proto.DescriptorsManager) proto.DescriptorsManager {
+			lifecycle.Append(fx.StopHook(manager.Close))
+
+			return manager
+		}),
+	)
+}
+
 func (c Container) buildDIContainer() fx.Option {
 	return fx.Provide(
 		config.NewServices,
-		config.NewTestCases,
+		config.NewStubs,
 		config.NewGlobal,
 		config.NewLogrusEntry,
-		proto.NewDescriptorsManager,
 		proto.NewClientsManager,
 		logic.NewVariables,
 		logic.NewResponseChecker,
 		logic.NewRunner,
 		logic.NewValidator,
 		logic.NewSetupHelper,
+		logic.NewReporter,
+		logic.NewMockServer,
+		logic.NewRecorder,
 		c.contextWrapper(c.ctx),
 	)
 }
@@ -68,13 +166,23 @@ func (c Container) contextWrapper(ctx *cli.Context) func() config.ContextWrapper
 	return func() config.ContextWrapper { return config.NewContextWrapper(ctx) }
 }
 
-func (c Container) runApp(invokes fx.Option) error {
+func (c Container) runApp(options ...fx.Option) error {
 	providers := c.buildDIContainer()
-	err := fx.New(providers, invokes, fx.NopLogger).Start(c.ctx.Context)
+	app := fx.New(append(options, providers, fx.NopLogger)...)
+	err := app.Start(c.ctx.Context)
+	if err == nil {
+		stopCtx, cancel := context.WithTimeout(context.Background(), app.StopTimeout())
+		defer cancel()
+		err = app.Stop(stopCtx)
+	}
 	var userErr models.UserErr
 	if !c.ctx.Bool("verbose") && errors.As(err, &userErr) {
 		return userErr
 	}
+	var problems logic.ValidationErrors
+	if !c.ctx.Bool("verbose") && errors.As(err, &problems) {
+		return problems
+	}
 
 	return err
 }
@@ -0,0 +1,142 @@
+package logic
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/res-am/grpc-fts/internal/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"time"
+)
+
+const defaultMessageTimeout = 5 * time.Second
+
+// converse runs the conversation of the step with bidirectional stream. Entries are run in order until the first
+// fail, values stored by expectations are set to the scope of the attempt at once, so next messages can use them.
+// They are applied to variables of the test case only if the attempt passes, like values stored by other steps.
+func (r *runner) converse(step config.Step, stored map[string]any) ([]models.ValidationFail, codes.Code, error) {
+	md, _, err := r.prepareRequest(step.Metadata, step.Service.Metadata, nil)
+	if err != nil {
+		return nil, codes.Unknown, errors.Wrap(err, "error on preparing request")
+	}
+
+	client := r.clients.GetClient(step.ServiceName)
+	response, err := client.Open(step.BuildProtoFullName(), metadata.New(md))
+	if err != nil {
+		return nil, codes.Unknown, errors.Wrapf(err, "error on calling service %s", step.ServiceName)
+	}
+	defer response.Close()
+
+	expected, err := r.prepareExpectations(step)
+	if err != nil {
+		return nil, codes.Unknown, errors.Wrap(err, "error on preparing expectations")
+	}
+
+	attempt := r.withVariables(nil)
+	for j, entry := range step.Conversation {
+		fails, err := attempt.converseEntry(client, response, j, entry, expected.status, stored)
+		if err != nil {
+			return fails, response.Status.Code(), err
+		}
+	}
+
+	fails, err := r.checkMetadata(nil, expected, response, stored)
+
+	return fails, response.Status.Code(), err
+}
+
+func (r *runner) converseEntry(
+	client proto.Client, response *proto.GRPCResponse, j int, entry config.ConversationEntry,
+	expectedStatus *config.Status, stored map[string]any,
+) ([]models.ValidationFail, error) {
+	field := fmt.Sprintf("conversation[%d]", j)
+	timeout := time.Duration(entry.Timeout)
+	if timeout == 0 {
+		timeout = defaultMessageTimeout
+	}
+
+	switch {
+	case entry.Send != nil:
+		request, err := r.variables.ReplaceInJson(entry.Send)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error on replacing variables in %s", field)
+		}
+		message, err := client.BuildRequest(response.RequestDescriptor(), request)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error on building %s", field)
+		}
+
+		return nil, errors.Wrap(response.StreamSend(message), field)
+	case entry.HalfClose:
+		return nil, errors.Wrap(response.CloseSend(), field)
+	case entry.Expect != nil:
+		expectations, err := r.prepareResponse(entry.Expect)
+		if err != nil {
+			return nil, errors.Wrap(err, field)
+		}
+
+		closed, err := r.receiveMessage(response, timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error on receiving %s", field)
+		}
+		if closed {
+			actual := fmt.Sprintf("stream finished with %s %s", response.Status.Code(), response.Status.Message())
+			fail := models.Fail(field, "expect", "message", actual)
+
+			return []models.ValidationFail{fail}, ErrValidationFailed
+		}
+
+		messageStored := make(map[string]any)
+		fails, err := r.checker.CheckResponse(response.Response, response.Descriptor(), expectations, messageStored)
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return nil, errors.Wrapf(err, "error checking %s", field)
+		}
+		if len(fails) > 0 {
+			return prefixFails(field, fails), ErrValidationFailed
+		}
+
+		r.variables.SetAll(messageStored)
+		mergeStored(stored, messageStored)
+
+		return nil, nil
+	case entry.ExpectClose:
+		closed, err := r.receiveMessage(response, timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error on receiving %s", field)
+		}
+		if !closed {
+			fail := models.Fail(field, "expect_close", "end of stream", "message "+formatVariable(response.Response))
+
+			return []models.ValidationFail{fail}, ErrValidationFailed
+		}
+
+		return r.checker.CheckStatus(response.Status, response.StatusDetails, expectedStatus, stored)
+	default:
+		return nil, errors.Errorf("%s should have send, expect, half_close or expect_close", field)
+	}
+}
+
+// receiveMessage receives the next message of the conversation, closed is set if the stream is finished.
+// Stream finished without error gets OK status.
+func (r *runner) receiveMessage(response *proto.GRPCResponse, timeout time.Duration) (closed bool, err error) {
+	err = response.StreamReceiveWithin(timeout)
+	switch {
+	case errors.Is(err, proto.ErrReceiveTimeout):
+		response.Status = status.New(codes.DeadlineExceeded, err.Error())
+
+		return true, nil
+	case errors.Is(err, io.EOF):
+		response.Status = status.New(codes.OK, "")
+		response.StatusDetails = nil
+
+		return true, nil
+	case err != nil:
+		return false, err
+	}
+
+	return response.Status.Code() != codes.OK, nil
+}
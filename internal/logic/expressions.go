@@ -0,0 +1,442 @@
+package logic
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/models"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type expressionFunction struct {
+	args int
+	call func(args []any) (any, error)
+}
+
+var expressionFunctions = map[string]expressionFunction{
+	"uuid":      {args: 0, call: uuidFunction},
+	"now":       {args: 0, call: func([]any) (any, error) { return time.Now(), nil }},
+	"env":       {args: 1, call: envFunction},
+	"randInt":   {args: 2, call: randIntFunction},
+	"base64":    {args: 1, call: base64Function},
+	"unix":      {args: 1, call: unixFunction(time.Time.Unix)},
+	"unixMilli": {args: 1, call: unixFunction(time.Time.UnixMilli)},
+}
+
+// expression is a parsed expression, which is evaluated on each substitution
+type expression interface {
+	evaluate() (any, error)
+}
+
+type literalExpression struct {
+	value any
+}
+
+type callExpression struct {
+	name     string
+	function expressionFunction
+	args     []expression
+}
+
+type binaryExpression struct {
+	operator    string
+	left, right expression
+}
+
+// evaluateExpression returns value of the expression, times are formatted as RFC 3339 strings
+func evaluateExpression(source string) (any, error) {
+	parsed, err := parseExpression(source)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := parsed.evaluate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "error evaluating expression %s", strings.TrimSpace(source))
+	}
+	if t, ok := value.(time.Time); ok {
+		return formatExpressionValue(t), nil
+	}
+
+	return value, nil
+}
+
+func formatExpressionValue(value any) string {
+	switch t := value.(type) {
+	case string:
+		return t
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case time.Time:
+		return t.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+func (e literalExpression) evaluate() (any, error) {
+	return e.value, nil
+}
+
+func (e callExpression) evaluate() (any, error) {
+	args := make([]any, 0, len(e.args))
+	for _, arg := range e.args {
+		value, err := arg.evaluate()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, value)
+	}
+
+	value, err := e.function.call(args)
+	if err != nil {
+		return nil, errors.Wrap(err, e.name)
+	}
+
+	return value, nil
+}
+
+// evaluate adds or subtracts numbers, shifts time by duration string, like now() + "1h", and concatenates strings
+func (e binaryExpression) evaluate() (any, error) {
+	left, err := e.left.evaluate()
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.evaluate()
+	if err != nil {
+		return nil, err
+	}
+
+	sign := int64(1)
+	if e.operator == "-" {
+		sign = -1
+	}
+
+	switch l := left.(type) {
+	case time.Time:
+		duration, ok := right.(string)
+		if !ok {
+			return nil, errors.Errorf("duration string was expected after %s time", e.operator)
+		}
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, errors.Wrapf(err, "malformed duration %s", duration)
+		}
+
+		return l.Add(time.Duration(sign) * d), nil
+	case int64:
+		switch r := right.(type) {
+		case int64:
+			return l + sign*r, nil
+		case float64:
+			return float64(l) + float64(sign)*r, nil
+		}
+	case float64:
+		switch r := right.(type) {
+		case int64:
+			return l + float64(sign*r), nil
+		case float64:
+			return l + float64(sign)*r, nil
+		}
+	case string:
+		if r, ok := right.(string); ok && e.operator == "+" {
+			return l + r, nil
+		}
+	}
+
+	return nil, errors.Errorf("operator %s is not supported for %T and %T", e.operator, left, right)
+}
+
+// expressionParser parses expressions of the grammar:
+//
+//	pipeline = sum { "|" name [ "(" args ")" ] }
+//	sum      = operand { ( "+" | "-" ) operand }
+//	operand  = name "(" [ args ] ")" | string | number | "-" number | "(" pipeline ")"
+//
+// value of the pipe is passed as the first argument of the function
+type expressionParser struct {
+	source string
+	tokens []string
+	pos    int
+}
+
+func parseExpression(source string) (expression, error) {
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, models.NewErr(fmt.Sprintf("invalid expression %s: %s", strings.TrimSpace(source), err.Error()))
+	}
+
+	p := &expressionParser{source: strings.TrimSpace(source), tokens: tokens}
+	result, err := p.pipeline()
+	if err == nil && p.pos < len(p.tokens) {
+		err = errors.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, models.NewErr(fmt.Sprintf("invalid expression %s: %s", p.source, err.Error()))
+	}
+
+	return result, nil
+}
+
+func (p *expressionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+
+	return ""
+}
+
+func (p *expressionParser) next() string {
+	token := p.peek()
+	if token != "" {
+		p.pos++
+	}
+
+	return token
+}
+
+func (p *expressionParser) expect(token string) error {
+	if actual := p.next(); actual != token {
+		if actual == "" {
+			return errors.Errorf("%s was expected at the end", token)
+		}
+
+		return errors.Errorf("%s was expected instead of %s", token, actual)
+	}
+
+	return nil
+}
+
+func (p *expressionParser) pipeline() (expression, error) {
+	result, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "|" {
+		p.next()
+		result, err = p.call(p.next(), result)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (p *expressionParser) sum() (expression, error) {
+	result, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "+" || p.peek() == "-" {
+		operator := p.next()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+
+		result = binaryExpression{operator: operator, left: result, right: right}
+	}
+
+	return result, nil
+}
+
+func (p *expressionParser) operand() (expression, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, errors.New("unexpected end")
+	case token == "(":
+		result, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+
+		return result, p.expect(")")
+	case token == "-" && isNumberToken(p.peek()):
+		return parseNumber("-" + p.next())
+	case token[0] == '"':
+		value, err := strconv.Unquote(token)
+		if err != nil {
+			return nil, errors.Errorf("malformed string %s", token)
+		}
+
+		return literalExpression{value: value}, nil
+	case isNumberToken(token):
+		return parseNumber(token)
+	case isNameToken(token) && p.peek() == "(":
+		return p.call(token, nil)
+	default:
+		return nil, errors.Errorf("unexpected %s", token)
+	}
+}
+
+// call parses arguments of the function, piped value is the first argument if it's given
+func (p *expressionParser) call(name string, piped expression) (expression, error) {
+	function, ok := expressionFunctions[name]
+	if !ok {
+		return nil, errors.Errorf("unknown function %s", name)
+	}
+
+	args := make([]expression, 0, function.args)
+	if piped != nil {
+		args = append(args, piped)
+	}
+
+	if piped == nil || p.peek() == "(" {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		for i := 0; p.peek() != ")"; i++ {
+			if i > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+
+			arg, err := p.pipeline()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+		}
+		p.next()
+	}
+
+	if len(args) != function.args {
+		return nil, errors.Errorf("function %s expects %d arguments, got %d", name, function.args, len(args))
+	}
+
+	return callExpression{name: name, function: function, args: args}, nil
+}
+
+func tokenizeExpression(source string) ([]string, error) {
+	tokens := make([]string, 0)
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("()|,+-", c):
+			tokens = append(tokens, string(c))
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(source) && source[end] != '"' {
+				if source[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, source[i:end+1])
+			i = end + 1
+		case unicode.IsDigit(c) || unicode.IsLetter(c) || c == '_' || c == '.':
+			end := i
+			for end < len(source) && (unicode.IsDigit(rune(source[end])) || unicode.IsLetter(rune(source[end])) ||
+				source[end] == '_' || source[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, source[i:end])
+			i = end
+		default:
+			return nil, errors.Errorf("unexpected %c", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+func isNumberToken(token string) bool {
+	return token != "" && unicode.IsDigit(rune(token[0]))
+}
+
+func isNameToken(token string) bool {
+	return token != "" && (unicode.IsLetter(rune(token[0])) || token[0] == '_')
+}
+
+func parseNumber(token string) (expression, error) {
+	if value, err := strconv.ParseInt(token, 10, 64); err == nil {
+		return literalExpression{value: value}, nil
+	}
+
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return nil, errors.Errorf("malformed number %s", token)
+	}
+
+	return literalExpression{value: value}, nil
+}
+
+// uuidFunction returns random UUID of version 4
+func uuidFunction([]any) (any, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "error generating uuid")
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+func envFunction(args []any) (any, error) {
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, errors.New("name of environment variable should be a string")
+	}
+
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, errors.Errorf("environment variable %s is not set", name)
+	}
+
+	return value, nil
+}
+
+// randIntFunction returns random integer in the range, both bounds are included
+func randIntFunction(args []any) (any, error) {
+	low, isLowInt := args[0].(int64)
+	high, isHighInt := args[1].(int64)
+	if !isLowInt || !isHighInt {
+		return nil, errors.New("integer bounds were expected")
+	}
+	if low > high {
+		return nil, errors.Errorf("lower bound %d is greater than upper bound %d", low, high)
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(high-low+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating random integer")
+	}
+
+	return low + n.Int64(), nil
+}
+
+func base64Function(args []any) (any, error) {
+	return base64.StdEncoding.EncodeToString([]byte(formatExpressionValue(args[0]))), nil
+}
+
+func unixFunction(convert func(time.Time) int64) func(args []any) (any, error) {
+	return func(args []any) (any, error) {
+		t, ok := args[0].(time.Time)
+		if !ok {
+			return nil, errors.New("time was expected, like now()")
+		}
+
+		return convert(t), nil
+	}
+}
@@ -0,0 +1,109 @@
+package logic
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/models"
+	"io"
+	"strings"
+)
+
+// githubReporter writes fails and errors of the run as annotations of GitHub workflows,
+// so they're shown inline on pull requests
+type githubReporter struct {
+	out io.Writer
+}
+
+func newGithubReporter(out io.Writer) *githubReporter {
+	return &githubReporter{out: out}
+}
+
+func (r *githubReporter) Report(report *models.Report) error {
+	var builder strings.Builder
+	r.phase(&builder, "global setup", report.Setup)
+	for _, testCase := range report.TestCases {
+		title := "test case " + testCase.Name
+		switch testCase.Status {
+		case models.StatusFailed:
+			r.fails(&builder, title, testCase.Steps)
+		case models.StatusErrored:
+			position := models.Position{}
+			if len(testCase.Steps) > 0 {
+				position = testCase.Steps[len(testCase.Steps)-1].Position
+			}
+			builder.WriteString(githubAnnotation(position, title+": "+testCase.Message))
+		case models.StatusPassed, models.StatusSkipped:
+		}
+
+		r.phase(&builder, title+" teardown", testCase.Teardown)
+	}
+	r.phase(&builder, "global teardown", report.Teardown)
+
+	if _, err := io.WriteString(r.out, builder.String()); err != nil {
+		return errors.Wrap(err, "error writing github annotations")
+	}
+
+	return nil
+}
+
+// phase annotates fails of the failed phase, phase failed with error is annotated at its last step
+func (r *githubReporter) phase(builder *strings.Builder, title string, phase *models.PhaseResult) {
+	if !phase.Failed() {
+		return
+	}
+
+	if !r.fails(builder, title, phase.Steps) {
+		position := models.Position{}
+		if len(phase.Steps) > 0 {
+			position = phase.Steps[len(phase.Steps)-1].Position
+		}
+		builder.WriteString(githubAnnotation(position, title+": "+phase.Message))
+	}
+}
+
+// fails annotates each fail of the steps at its expectation, it reports whether there were any fails
+func (r *githubReporter) fails(builder *strings.Builder, title string, steps []models.StepResult) bool {
+	found := false
+	for _, step := range steps {
+		for _, fail := range step.Fails {
+			found = true
+			message := fmt.Sprintf("%s, %s: field: %s, function: %s, expected: %v, actual: %s",
+				title, step.Name, fail.Field, fail.Function, fail.Expectation, fail.ActualValue)
+			builder.WriteString(githubAnnotation(fail.Position, message))
+		}
+	}
+
+	return found
+}
+
+// WriteGithubAnnotations writes problems of validation as annotations of GitHub workflows
+func WriteGithubAnnotations(out io.Writer, problems ValidationErrors) error {
+	var builder strings.Builder
+	for _, problem := range problems {
+		builder.WriteString(githubAnnotation(problem.Position, problem.Err.Error()))
+	}
+
+	if _, err := io.WriteString(out, builder.String()); err != nil {
+		return errors.Wrap(err, "error writing github annotations")
+	}
+
+	return nil
+}
+
+// githubAnnotation returns error command of GitHub workflows, unknown position is omitted
+func githubAnnotation(position models.Position, message string) string {
+	if !position.IsKnown() {
+		return "::error::" + escapeGithubData(message) + "\n"
+	}
+
+	return fmt.Sprintf("::error file=%s,line=%d,col=%d::%s\n",
+		escapeGithubProperty(position.File), position.Line, position.Column, escapeGithubData(message))
+}
+
+func escapeGithubData(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(value)
+}
+
+func escapeGithubProperty(value string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(value)
+}
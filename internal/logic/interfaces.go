@@ -1,9 +1,13 @@
 package logic
 
 import (
+	"context"
 	"github.com/res-am/grpc-fts/internal/config"
 	"github.com/res-am/grpc-fts/internal/models"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"net"
 )
 
 type Runner interface {
@@ -11,8 +15,14 @@ type Runner interface {
 }
 
 type ResponseChecker interface {
-	CheckResponse(response map[string]interface{}, expectations map[string]interface{}) ([]models.ValidationFail, error)
-	CheckStatus(status *status.Status, cfg *config.Status) ([]models.ValidationFail, error)
+	// CheckResponse collects values of store function to stored map, they're not applied to variables.
+	// Descriptor of the response message is optional, values are compared by their json representation without it.
+	CheckResponse(
+		response map[string]interface{}, descriptor protoreflect.MessageDescriptor,
+		expectations map[string]interface{}, stored map[string]any,
+	) ([]models.ValidationFail, error)
+	CheckMetadata(name string, md metadata.MD, expectations map[string]any, stored map[string]any) ([]models.ValidationFail, error)
+	CheckStatus(status *status.Status, details []any, cfg *config.Status, stored map[string]any) ([]models.ValidationFail, error)
 	FunctionExists(function string) bool
 }
 
@@ -23,3 +33,15 @@ type Validator interface {
 type SetupHelper interface {
 	Setup() error
 }
+
+type Recorder interface {
+	Record() error
+}
+
+type MockServer interface {
+	Serve(ctx context.Context, listener net.Listener) error
+}
+
+type Reporter interface {
+	Report(report *models.Report) error
+}
@@ -0,0 +1,174 @@
+package logic
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/models"
+	"os"
+	"strings"
+	"time"
+)
+
+const junitSuiteName = "grpc-fts"
+
+type junitReporter struct {
+	path string
+}
+
+func newJUnitReporter(path string) Reporter {
+	return &junitReporter{path: path}
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+	SystemErr string          `xml:"system-err,omitempty"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+func (r *junitReporter) Report(report *models.Report) error {
+	suite := junitTestSuite{
+		Name:      junitSuiteName,
+		Tests:     len(report.TestCases),
+		Failures:  report.Count(models.StatusFailed),
+		Errors:    report.Count(models.StatusErrored),
+		Skipped:   report.Count(models.StatusSkipped),
+		Time:      junitTime(report.Duration),
+		Timestamp: report.StartedAt.Format(time.RFC3339),
+		TestCases: make([]junitTestCase, 0, len(report.TestCases)),
+	}
+	for _, result := range report.TestCases {
+		suite.TestCases = append(suite.TestCases, r.buildTestCase(result))
+	}
+	// global steps don't belong to any test case, so their failures are reported for the suite
+	if report.Setup.Failed() {
+		suite.SystemErr += "global setup failed: " + report.Setup.Message + "\n" + r.failureBody(report.Setup.Steps)
+	}
+	if report.Teardown.Failed() {
+		suite.SystemErr += "global teardown failed: " + report.Teardown.Message + "\n" + r.failureBody(report.Teardown.Steps)
+	}
+
+	suites := junitTestSuites{
+		Name:     junitSuiteName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	content, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error marshalling junit report")
+	}
+
+	err = os.WriteFile(r.path, append([]byte(xml.Header), content...), 0o600)
+	if err != nil {
+		return errors.Wrapf(err, "error writing junit report to %s", r.path)
+	}
+
+	return nil
+}
+
+func (r *junitReporter) buildTestCase(result models.TestCaseResult) junitTestCase {
+	testCase := junitTestCase{
+		Name:      result.Name,
+		ClassName: junitSuiteName,
+		Time:      junitTime(result.Duration),
+		SystemOut: r.stepsTiming(result.Steps),
+	}
+
+	switch result.Status {
+	case models.StatusFailed:
+		testCase.Failure = &junitMessage{
+			Message: "validation failed",
+			Type:    "ValidationFail",
+			Body:    r.failureBody(result.Steps),
+		}
+	case models.StatusErrored:
+		testCase.Error = &junitMessage{Message: result.Message, Type: "Error"}
+	case models.StatusSkipped:
+		testCase.Skipped = &junitMessage{Message: result.Message}
+	case models.StatusPassed:
+	}
+
+	// teardown failure doesn't change the status of the test case
+	if result.Teardown.Failed() {
+		testCase.SystemErr = "teardown failed: " + result.Teardown.Message + "\n" + r.failureBody(result.Teardown.Steps)
+	}
+
+	return testCase
+}
+
+func (r *junitReporter) failureBody(steps []models.StepResult) string {
+	var builder strings.Builder
+	for _, step := range steps {
+		if len(step.Fails) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&builder, "%s (%s.%s, %s):\n", step.Name, step.Service, step.Method, step.Duration)
+		for _, fail := range step.Fails {
+			location := ""
+			if fail.Position.IsKnown() {
+				location = fail.Position.String() + ": "
+			}
+			fmt.Fprintf(&builder, "  %sfield: %s, function: %s, expected: %v, actual: %s\n",
+				location, fail.Field, fail.Function, fail.Expectation, fail.ActualValue)
+		}
+	}
+
+	return builder.String()
+}
+
+func (r *junitReporter) stepsTiming(steps []models.StepResult) string {
+	var builder strings.Builder
+	for _, step := range steps {
+		fmt.Fprintf(&builder, "%s %s.%s: %s", step.Name, step.Service, step.Method, step.Duration)
+		if step.Attempts > 1 {
+			fmt.Fprintf(&builder, ", attempts: %d", step.Attempts)
+		}
+		builder.WriteString("\n")
+	}
+
+	return builder.String()
+}
+
+func junitTime(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
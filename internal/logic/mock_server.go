@@ -0,0 +1,349 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/res-am/grpc-fts/internal/proto"
+	"github.com/sirupsen/logrus"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type mockServer struct {
+	stubs   []mockStub
+	manager proto.DescriptorsManager
+	checker ResponseChecker
+	logger  *logrus.Entry
+}
+
+// mockStub is a stub with parsed matchers and built response messages
+type mockStub struct {
+	source   string
+	method   protoreflect.FullName
+	request  map[string]any
+	metadata map[string]any
+	messages []*dynamicpb.Message
+	// status is nil for successful calls
+	status  *status.Status
+	latency time.Duration
+}
+
+func NewMockServer(
+	stubs config.Stubs, manager proto.DescriptorsManager, checker ResponseChecker, variables *Variables, logger *logrus.Entry,
+) (MockServer, error) {
+	server := &mockServer{manager: manager, checker: checker, logger: logger, stubs: make([]mockStub, 0, len(stubs))}
+	for _, stub := range stubs {
+		prepared, err := server.prepareStub(stub, variables)
+		if err != nil {
+			return nil, errors.Wrapf(err, "stub %s", stub.Source)
+		}
+
+		server.stubs = append(server.stubs, prepared)
+	}
+
+	return server, nil
+}
+
+func (s *mockServer) prepareStub(stub config.Stub, variables *Variables) (mockStub, error) {
+	descriptor := s.manager.GetDescriptor(stub.BuildProtoFullName())
+	result := mockStub{source: stub.Source, method: descriptor.FullName(), latency: time.Duration(stub.Latency)}
+
+	var err error
+	if result.request, err = prepareMatchers(stub.Request, variables); err != nil {
+		return result, errors.Wrap(err, "request")
+	}
+	if result.metadata, err = prepareMatchers(stub.Metadata, variables); err != nil {
+		return result, errors.Wrap(err, "metadata")
+	}
+
+	if len(stub.Stream) > 0 && !descriptor.IsStreamingServer() {
+		return result, models.NewErr(fmt.Sprintf("method %s is not server streaming, use response instead of stream", descriptor.FullName()))
+	}
+
+	responses := stub.Stream
+	if !descriptor.IsStreamingServer() || (len(responses) == 0 && len(stub.Response) > 0) {
+		responses = []json.RawMessage{stub.Response}
+	}
+	for i, response := range responses {
+		message, err := s.buildMessage(descriptor.Output(), response, variables)
+		if err != nil {
+			return result, errors.Wrapf(err, "response message #%d", i+1)
+		}
+
+		result.messages = append(result.messages, message)
+	}
+
+	if stub.Status != nil {
+		if result.status, err = s.buildStatus(stub.Status); err != nil {
+			return result, errors.Wrap(err, "status")
+		}
+	}
+
+	// unary calls finished with an error don't have a response message
+	if result.status.Code() != codes.OK && !descriptor.IsStreamingServer() {
+		result.messages = nil
+	}
+
+	return result, nil
+}
+
+func prepareMatchers(raw json.RawMessage, variables *Variables) (map[string]any, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	replaced, err := variables.ReplaceInJson(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on replacing variables")
+	}
+
+	var matchers map[string]any
+	if err := json.Unmarshal(replaced, &matchers); err != nil {
+		return nil, errors.Wrap(err, "error on unmarshalling matchers")
+	}
+
+	return matchers, nil
+}
+
+func (s *mockServer) buildMessage(desc protoreflect.MessageDescriptor, raw json.RawMessage, variables *Variables) (*dynamicpb.Message, error) {
+	message := dynamicpb.NewMessage(desc)
+	if len(raw) == 0 {
+		return message, nil
+	}
+
+	replaced, err := variables.ReplaceInJson(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on replacing variables")
+	}
+
+	err = protojson.UnmarshalOptions{Resolver: s.manager.Resolver()}.Unmarshal(replaced, message)
+	if err != nil {
+		return nil, models.NewErr(fmt.Sprintf("invalid %s message: %s", desc.FullName(), err.Error()))
+	}
+
+	return message, nil
+}
+
+func (s *mockServer) buildStatus(cfg *config.StubStatus) (*status.Status, error) {
+	code, ok := parseCode(cfg.Code)
+	if !ok {
+		return nil, models.NewErr(fmt.Sprintf("unknown status code %s", cfg.Code))
+	}
+
+	result := &spb.Status{Code: int32(code), Message: cfg.Message}
+	for i, raw := range cfg.Details {
+		detail := new(anypb.Any)
+		err := protojson.UnmarshalOptions{Resolver: s.manager.Resolver()}.Unmarshal(raw, detail)
+		if err != nil {
+			return nil, models.NewErr(fmt.Sprintf("invalid detail #%d: %s", i+1, err.Error()))
+		}
+
+		result.Details = append(result.Details, detail)
+	}
+
+	return status.FromProto(result), nil
+}
+
+// Serve handles calls of all stubbed methods until the context is done or the process is interrupted
+func (s *mockServer) Serve(ctx context.Context, listener net.Listener) error {
+	server := grpc.NewServer(grpc.UnknownServiceHandler(s.handle))
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	s.logger.Infof("mock server is listening on %s, %d stubs loaded", listener.Addr(), len(s.stubs))
+	if err := server.Serve(listener); err != nil {
+		return errors.Wrap(err, "mock server error")
+	}
+
+	return nil
+}
+
+func (s *mockServer) handle(_ any, stream grpc.ServerStream) error {
+	fullMethod, _ := grpc.MethodFromServerStream(stream)
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", "."))
+	logger := s.logger.WithField("method", name)
+
+	descriptor := s.manager.GetDescriptor(name)
+	if descriptor == nil {
+		logger.Warn("call of the method without stubs")
+
+		return status.Errorf(codes.Unimplemented, "method %s has no stubs", name)
+	}
+
+	request, err := s.receive(stream, descriptor)
+	if err != nil {
+		logger.WithError(err).Warn("error on receiving request")
+
+		return err
+	}
+
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	logger = logger.WithFields(logrus.Fields{"request": request, "metadata": md})
+
+	stub := s.match(logger, descriptor, request, md)
+	if stub == nil {
+		logger.Warn("call doesn't match any stub")
+
+		return status.Errorf(codes.NotFound, "no stub matches the call of %s", name)
+	}
+
+	logger.WithField("stub", stub.source).Info("call received")
+
+	return s.respond(stream, stub)
+}
+
+// receive reads the request message, messages of client streaming calls are collected to `stream` array
+func (s *mockServer) receive(stream grpc.ServerStream, descriptor protoreflect.MethodDescriptor) (map[string]any, error) {
+	if !descriptor.IsStreamingClient() {
+		return s.receiveMessage(stream, descriptor.Input())
+	}
+
+	messages := make([]any, 0)
+	for {
+		message, err := s.receiveMessage(stream, descriptor.Input())
+		if errors.Is(err, io.EOF) {
+			return map[string]any{"stream": messages}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		messages = append(messages, message)
+	}
+}
+
+func (s *mockServer) receiveMessage(stream grpc.ServerStream, desc protoreflect.MessageDescriptor) (map[string]any, error) {
+	message := dynamicpb.NewMessage(desc)
+	if err := stream.RecvMsg(message); err != nil {
+		return nil, err
+	}
+
+	b, err := protojson.MarshalOptions{EmitUnpopulated: true, Resolver: s.manager.Resolver()}.Marshal(message)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal request from proto to json")
+	}
+
+	var result map[string]any
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal request from json to structure")
+	}
+
+	return result, nil
+}
+
+// match returns the first stub of the method which matchers pass, stubs are checked in order of loading
+func (s *mockServer) match(
+	logger *logrus.Entry, descriptor protoreflect.MethodDescriptor, request map[string]any, md metadata.MD,
+) *mockStub {
+	for i := range s.stubs {
+		stub := &s.stubs[i]
+		if stub.method != descriptor.FullName() {
+			continue
+		}
+
+		ok, err := s.matches(stub, descriptor, request, md)
+		if err != nil {
+			logger.WithError(err).Warnf("error on matching stub %s", stub.source)
+
+			continue
+		}
+		if ok {
+			return stub
+		}
+	}
+
+	return nil
+}
+
+func (s *mockServer) matches(stub *mockStub, descriptor protoreflect.MethodDescriptor, request map[string]any, md metadata.MD) (bool, error) {
+	input := descriptor.Input()
+	if descriptor.IsStreamingClient() {
+		// request is wrapped to `stream` array, which is not a field of the message
+		input = nil
+	}
+
+	if stub.request != nil {
+		fails, err := s.checker.CheckResponse(request, input, stub.request, make(map[string]any))
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return false, err
+		}
+		if len(fails) > 0 {
+			return false, nil
+		}
+	}
+
+	if stub.metadata != nil {
+		fails, err := s.checker.CheckMetadata("metadata", md, stub.metadata, make(map[string]any))
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return false, err
+		}
+		if len(fails) > 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// respond sends messages of the stub with latency before each one, then finishes the call with the stub status
+func (s *mockServer) respond(stream grpc.ServerStream, stub *mockStub) error {
+	for _, message := range stub.messages {
+		if err := s.sleep(stream.Context(), stub.latency); err != nil {
+			return err
+		}
+		if err := stream.SendMsg(message); err != nil {
+			return err
+		}
+	}
+
+	if len(stub.messages) == 0 {
+		if err := s.sleep(stream.Context(), stub.latency); err != nil {
+			return err
+		}
+	}
+
+	if stub.status != nil {
+		return stub.status.Err()
+	}
+
+	return nil
+}
+
+func (s *mockServer) sleep(ctx context.Context, latency time.Duration) error {
+	if latency <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(latency)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,146 @@
+package logic_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bufbuild/protocompile"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/logic"
+	"github.com/res-am/grpc-fts/internal/proto"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// testDescriptors resolves methods of test.proto
+type testDescriptors struct {
+	service protoreflect.ServiceDescriptor
+}
+
+func newTestDescriptors(t *testing.T) testDescriptors {
+	c := &protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: []string{"../proto/test_data"},
+		}),
+	}
+	compiled, err := c.Compile(context.Background(), "test.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testDescriptors{service: compiled[0].Services().ByName("TestService")}
+}
+
+func (d testDescriptors) GetDescriptor(name protoreflect.FullName) protoreflect.MethodDescriptor {
+	if name.Parent() != d.service.FullName() {
+		return nil
+	}
+
+	return d.service.Methods().ByName(name.Name())
+}
+
+func (d testDescriptors) Resolver() proto.Resolver {
+	return protoregistry.GlobalTypes
+}
+
+func (d testDescriptors) Close() error {
+	return nil
+}
+
+func testStub(method, request, response string) config.Stub {
+	stub := config.Stub{
+		ServiceName: "test", Method: method, Service: config.Service{Service: "test.TestService"}, Source: method,
+	}
+	if request != "" {
+		stub.Request = json.RawMessage(request)
+	}
+	if response != "" {
+		stub.Response = json.RawMessage(response)
+	}
+
+	return stub
+}
+
+func TestMockServer_Serve(t *testing.T) {
+	notFound := testStub("UnaryMethod", "", "")
+	notFound.Status = &config.StubStatus{
+		Code:    "NOT_FOUND",
+		Message: "not found",
+		Details: []json.RawMessage{[]byte(`{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "MISSING"}`)},
+	}
+	stream := testStub("ServerStreamMethod", "", "")
+	stream.Stream = []json.RawMessage{[]byte(`{"data": "1"}`), []byte(`{"data": "2"}`)}
+	stream.Latency = config.Duration(time.Millisecond)
+
+	descriptors := newTestDescriptors(t)
+	variables, err := logic.NewVariables(newRunContext(t))
+	assert.NoError(t, err)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	server, err := logic.NewMockServer(config.Stubs{
+		testStub("UnaryMethod", `{"data": {"one_of": ["a", "b"]}}`, `{"data": "stubbed"}`),
+		notFound,
+		stream,
+	}, descriptors, logic.NewResponseChecker(variables), variables, logrus.NewEntry(logger))
+	assert.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		assert.NoError(t, server.Serve(ctx, listener))
+	}()
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	unary := descriptors.GetDescriptor("test.TestService.UnaryMethod")
+	request := dynamicpb.NewMessage(unary.Input())
+	request.Set(unary.Input().Fields().ByName("data"), protoreflect.ValueOfString("a"))
+	response := dynamicpb.NewMessage(unary.Output())
+	err = conn.Invoke(ctx, "/test.TestService/UnaryMethod", request, response)
+	assert.NoError(t, err)
+	assert.Equal(t, "stubbed", response.Get(unary.Output().Fields().ByName("data")).String())
+
+	request.Set(unary.Input().Fields().ByName("data"), protoreflect.ValueOfString("c"))
+	err = conn.Invoke(ctx, "/test.TestService/UnaryMethod", request, dynamicpb.NewMessage(unary.Output()))
+	st := status.Convert(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		assert.Equal(t, "MISSING", st.Details()[0].(*errdetails.ErrorInfo).GetReason())
+	}
+
+	serverStream := descriptors.GetDescriptor("test.TestService.ServerStreamMethod")
+	clientStream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/test.TestService/ServerStreamMethod")
+	assert.NoError(t, err)
+	assert.NoError(t, clientStream.SendMsg(dynamicpb.NewMessage(serverStream.Input())))
+	assert.NoError(t, clientStream.CloseSend())
+
+	received := make([]string, 0)
+	for {
+		message := dynamicpb.NewMessage(serverStream.Output())
+		if err := clientStream.RecvMsg(message); err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+
+			break
+		}
+		received = append(received, message.Get(serverStream.Output().Fields().ByName("data")).String())
+	}
+	assert.Equal(t, []string{"1", "2"}, received)
+
+	err = conn.Invoke(ctx, "/test.OtherService/UnaryMethod", request, dynamicpb.NewMessage(unary.Output()))
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
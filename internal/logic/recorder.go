@@ -0,0 +1,362 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/res-am/grpc-fts/internal/proto"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+)
+
+type recorder struct {
+	runner *runner
+	target string
+	ignore map[string]struct{}
+}
+
+// recording is the actual result of the step, written as its expectations, nil values remove expectations
+type recording struct {
+	response any
+	status   any
+}
+
+func NewRecorder(
+	ctx config.ContextWrapper, testCases config.TestCases, clients proto.ClientsManager, logger *logrus.Entry,
+	checker ResponseChecker, variables *Variables, global *config.Global,
+) Recorder {
+	ignore := make(map[string]struct{})
+	for _, path := range ctx.IgnoreFlag() {
+		ignore[path] = struct{}{}
+	}
+
+	return &recorder{
+		runner: &runner{
+			testCases: testCases, clients: clients, logger: logger, checker: checker, variables: variables, global: global,
+			parallel: 1,
+		},
+		target: ctx.TargetFlag(),
+		ignore: ignore,
+	}
+}
+
+// Record runs global setup and dependencies of the target test case, then calls steps of the target and rewrites
+// its file with actual responses as expectations
+func (r *recorder) Record() error {
+	if r.target == "" {
+		return models.NewErr("target test case is required, use --target option")
+	}
+
+	global := r.runner.global
+	if len(global.Setup) > 0 {
+		if setup := r.runner.runGlobalSetup(); setup.Failed() {
+			return models.NewErr("global setup failed: " + setup.Message)
+		}
+	}
+
+	err := r.recordTarget()
+	if len(global.Teardown) > 0 {
+		teardown := r.runner.runTeardown(globalSteps, "global teardown step", global.Teardown, r.runner.logger)
+		// failed recording is reported first, teardown problems are already logged
+		if teardown.Failed() && err == nil {
+			err = models.NewErr("global teardown failed: " + teardown.Message)
+		}
+	}
+
+	return err
+}
+
+// recordTarget runs test cases before the target as its dependencies and records the target
+func (r *recorder) recordTarget() error {
+	for _, testCase := range r.runner.testCases {
+		if testCase.Name == r.target {
+			return r.recordTestCase(testCase)
+		}
+		if testCase.Group == r.target {
+			return models.NewErr(fmt.Sprintf("test case %s has examples, target one of its instances, like %s", r.target, testCase.Name))
+		}
+
+		result, err := r.runner.runTestCase(testCase, r.runner.logger)
+		if err != nil {
+			return errors.Wrapf(err, "dependency %s", testCase.Name)
+		}
+		if result.Status != models.StatusPassed {
+			return models.NewErr(fmt.Sprintf("dependency %s failed", testCase.Name))
+		}
+	}
+
+	return models.NewErr(fmt.Sprintf("test case %s not found", r.target))
+}
+
+func (r *recorder) recordTestCase(testCase config.TestCase) error {
+	scoped := *r
+	scoped.runner = r.runner.withVariables(testCase.Variables)
+	r = &scoped
+
+	file, err := config.ReadTestCaseFile(testCase.File)
+	if err != nil {
+		return err
+	}
+
+	err = r.recordSteps(testCase, file)
+	if len(testCase.Teardown) > 0 {
+		teardown := r.runner.runTeardown(testCase.Name, "teardown step", testCase.Teardown, r.runner.logger)
+		// failed recording is reported first, teardown problems are already logged
+		if teardown.Failed() && err == nil {
+			err = models.NewErr(fmt.Sprintf("teardown of test case %s failed: %s", testCase.Name, teardown.Message))
+		}
+	}
+
+	return err
+}
+
+// recordSteps runs setup of the test case, records its steps and writes them to the file
+func (r *recorder) recordSteps(testCase config.TestCase, file *config.TestCaseFile) error {
+	setup := models.TestCaseResult{Status: models.StatusPassed}
+	err := r.runner.runSteps(testCase.Name, "setup step", testCase.Setup, &setup, r.runner.logger)
+	if err != nil {
+		return err
+	}
+	if setup.Status != models.StatusPassed {
+		return models.NewErr(fmt.Sprintf("setup of test case %s failed", testCase.Name))
+	}
+
+	for i, step := range testCase.Steps {
+		if len(step.Conversation) > 0 {
+			// conversations are kept as is, they're run so next steps get their stored values
+			if _, err := r.runner.runStep(snapshotName(testCase.Name, "step", i), step); err != nil {
+				return errors.Wrapf(err, "step %d", i+1)
+			}
+
+			continue
+		}
+
+		result, err := r.recordStep(step)
+		if err != nil {
+			return errors.Wrapf(err, "step %d", i+1)
+		}
+
+		if err := file.SetStepField(i, "response", result.response); err != nil {
+			return err
+		}
+		if err := file.SetStepField(i, "status", result.status); err != nil {
+			return err
+		}
+	}
+
+	if err := file.Write(); err != nil {
+		return err
+	}
+	r.runner.logger.Infof("test case %s is recorded to %s", testCase.Name, testCase.File)
+
+	return nil
+}
+
+// recordStep calls the step and merges the actual response with its expectations.
+// Values of store functions are applied even if other expectations fail, so next steps can use them.
+func (r *recorder) recordStep(step config.Step) (recording, error) {
+	response, err := r.runner.call(step)
+	if err != nil {
+		return recording{}, err
+	}
+	defer response.Close()
+
+	expected, err := r.runner.prepareExpectations(step)
+	if err != nil {
+		return recording{}, errors.Wrap(err, "error on preparing expectations")
+	}
+
+	// variables are not replaced in expectations which are written back
+	var raw map[string]any
+	if len(step.Response) > 0 {
+		if err := json.Unmarshal(step.Response, &raw); err != nil {
+			return recording{}, errors.Wrap(err, "error on unmarshalling response")
+		}
+	}
+
+	stopAfter := 0
+	if response.IsStream {
+		stream, err := newStreamExpectations(expected.response)
+		if err != nil {
+			return recording{}, err
+		}
+		stopAfter = stream.stopAfter
+	}
+
+	messages, err := r.receive(response, stopAfter)
+	if err != nil {
+		return recording{}, err
+	}
+
+	stored := make(map[string]any)
+	result := recording{status: r.recordStatus(step.Status, response)}
+	if !response.IsStream {
+		_, _ = r.runner.checker.CheckResponse(messages[0], response.Descriptor(), expected.response, stored)
+		recorded := r.merge("", raw, messages[0]).(map[string]any)
+		if len(recorded) > 0 || raw != nil {
+			result.response = recorded
+		}
+		r.runner.variables.SetAll(stored)
+
+		return result, nil
+	}
+
+	var expectedStream, rawStream []any
+	if stream, ok := expected.response["stream"].([]any); ok {
+		expectedStream = stream
+	}
+	if stream, ok := raw["stream"].([]any); ok {
+		rawStream = stream
+	}
+
+	recorded := make([]any, 0, len(messages))
+	for j, message := range messages {
+		if j < len(expectedStream) {
+			if expectations, ok := expectedStream[j].(map[string]any); ok {
+				_, _ = r.runner.checker.CheckResponse(message, response.Descriptor(), expectations, stored)
+			}
+		}
+
+		var rawMessage any
+		if j < len(rawStream) {
+			rawMessage = rawStream[j]
+		}
+		recorded = append(recorded, r.merge("", rawMessage, message))
+	}
+	// other stream expectations, like count or last, are kept as is
+	recordedStream := make(map[string]any, len(raw)+1)
+	for key, value := range raw {
+		recordedStream[key] = value
+	}
+	recordedStream["stream"] = recorded
+	result.response = recordedStream
+	r.runner.variables.SetAll(stored)
+
+	return result, nil
+}
+
+// receive returns the response message, or messages of the stream until it's finished, failed
+// or stopAfter messages are received
+func (r *recorder) receive(response *proto.GRPCResponse, stopAfter int) ([]map[string]any, error) {
+	if !response.IsStream {
+		return []map[string]any{response.Response}, nil
+	}
+
+	messages, _, err := receiveStream(response, stopAfter)
+
+	return messages, err
+}
+
+// recordStatus returns the actual status if it's not OK
+func (r *recorder) recordStatus(expected *config.Status, response *proto.GRPCResponse) any {
+	if response.Status.Code() == codes.OK {
+		return nil
+	}
+
+	actual := map[string]any{"code": response.Status.Code().String(), "message": response.Status.Message()}
+	if len(response.StatusDetails) > 0 {
+		actual["details"] = response.StatusDetails
+	}
+
+	var expectedStatus map[string]any
+	if expected != nil {
+		expectedStatus = make(map[string]any)
+		for key, value := range map[string]any{"code": expected.Code, "message": expected.Message, "details": expected.Details} {
+			if value != nil {
+				expectedStatus[key] = value
+			}
+		}
+	}
+
+	return r.merge("status", expectedStatus, actual)
+}
+
+// merge builds expectation from the actual value. Expectations with functions or variables are kept as is,
+// as well as expected ignored fields. Fields with default values are recorded only if they're already expected.
+func (r *recorder) merge(path string, expected, actual any) any {
+	if expectedObject, ok := expected.(map[string]any); ok && r.hasFunctions(expectedObject) {
+		return expected
+	}
+	if expectedString, ok := expected.(string); ok && isSubstituted(expectedString) {
+		return expected
+	}
+
+	switch t := actual.(type) {
+	case map[string]any:
+		expectedObject, _ := expected.(map[string]any)
+		result := make(map[string]any, len(t))
+		for key, value := range t {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+
+			expectedValue, isExpected := expectedObject[key]
+			if _, ignored := r.ignore[fieldPath]; ignored {
+				if isExpected {
+					result[key] = expectedValue
+				}
+
+				continue
+			}
+
+			merged := r.merge(fieldPath, expectedValue, value)
+			if isExpected || !isDefault(merged) {
+				result[key] = merged
+			}
+		}
+
+		return result
+	case []any:
+		expectedItems, _ := expected.([]any)
+		result := make([]any, 0, len(t))
+		for i, item := range t {
+			var expectedItem any
+			if i < len(expectedItems) {
+				expectedItem = expectedItems[i]
+			}
+
+			result = append(result, r.merge(path, expectedItem, item))
+		}
+
+		return result
+	default:
+		return actual
+	}
+}
+
+// isSubstituted reports whether the expectation contains variables, references or expressions
+func isSubstituted(expectation string) bool {
+	return substitutionRegExp.MatchString(expectation)
+}
+
+func (r *recorder) hasFunctions(expectation map[string]any) bool {
+	for key := range expectation {
+		if r.runner.checker.FunctionExists(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isDefault(value any) bool {
+	switch t := value.(type) {
+	case nil:
+		return true
+	case string:
+		return t == ""
+	case float64:
+		return t == 0
+	case bool:
+		return !t
+	case []any:
+		return len(t) == 0
+	case map[string]any:
+		return len(t) == 0
+	default:
+		return false
+	}
+}
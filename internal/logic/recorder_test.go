@@ -0,0 +1,128 @@
+package logic_test
+
+import (
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/logic"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const recordedTestCase = `# echo test case
+steps:
+  - service: test
+    method: UnaryMethod
+    request:
+      data: hello
+    response:
+      data: outdated
+  - service: test
+    method: UnaryMethod
+    request:
+      data: hello
+    # function expectations are kept
+    response:
+      data: { store: echoed }
+  - service: test
+    method: UnaryMethod
+    request:
+      data: $echoed
+`
+
+func TestRecorder_Record(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), 0o700))
+	path := filepath.Join(dir, "test-cases", "echo.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(recordedTestCase), 0o600))
+
+	ctx := newRunContext(t, "--configs", dir, "--target", "echo")
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	testCases, err := config.NewTestCases(ctx, logrus.NewEntry(logger), config.Services{
+		"test": {Service: "test.TestService"},
+	})
+	assert.NoError(t, err)
+
+	variables, err := logic.NewVariables(ctx)
+	assert.NoError(t, err)
+	recorder := logic.NewRecorder(
+		ctx, testCases, echoClientsManager{}, logrus.NewEntry(logger), logic.NewResponseChecker(variables), variables, &config.Global{},
+	)
+	assert.NoError(t, recorder.Record())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `# echo test case
+steps:
+  - service: test
+    method: UnaryMethod
+    request:
+      data: hello
+    response:
+      data: hello
+  - service: test
+    method: UnaryMethod
+    request:
+      data: hello
+    # function expectations are kept
+    response:
+      data:
+        store: echoed
+  - service: test
+    method: UnaryMethod
+    request:
+      data: $echoed
+    response:
+      data: hello
+`, string(content))
+}
+
+const failingTeardownTestCase = `steps:
+  - service: test
+    method: UnaryMethod
+    request:
+      data: hello
+teardown:
+  - service: test
+    method: UnaryMethod
+    request:
+      data: bye
+    response:
+      data: hello
+`
+
+func newTeardownRecorder(t *testing.T, testCase string, global *config.Global) logic.Recorder {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "echo.yaml"), []byte(testCase), 0o600))
+
+	ctx := newRunContext(t, "--configs", dir, "--target", "echo")
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	testCases, err := config.NewTestCases(ctx, logrus.NewEntry(logger), config.Services{
+		"test": {Service: "test.TestService"},
+	})
+	assert.NoError(t, err)
+
+	variables, err := logic.NewVariables(ctx)
+	assert.NoError(t, err)
+
+	return logic.NewRecorder(
+		ctx, testCases, echoClientsManager{}, logrus.NewEntry(logger), logic.NewResponseChecker(variables), variables, global,
+	)
+}
+
+func TestRecorder_Record_TeardownFailed(t *testing.T) {
+	recorder := newTeardownRecorder(t, failingTeardownTestCase, &config.Global{})
+	assert.ErrorContains(t, recorder.Record(), "teardown of test case echo failed: test case echo, teardown step 1 failed")
+
+	global := &config.Global{Teardown: []config.Step{{
+		ServiceName: "test", Method: "UnaryMethod", Service: config.Service{Service: "test.TestService"},
+		Request: []byte(`{"data": "bye"}`), Response: []byte(`{"data": "hello"}`),
+	}}}
+	recorder = newTeardownRecorder(t, recordedTestCase, global)
+	assert.ErrorContains(t, recorder.Record(), "global teardown failed: global teardown step 1 failed")
+}
@@ -0,0 +1,58 @@
+package logic
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
+	"os"
+	"strings"
+)
+
+type reporters []Reporter
+
+func NewReporter(ctx config.ContextWrapper) (Reporter, error) {
+	result := make(reporters, 0, len(ctx.ReportFlag()))
+	for _, report := range ctx.ReportFlag() {
+		kind, path, found := strings.Cut(report, "=")
+		if !found || path == "" {
+			return nil, models.NewErr(fmt.Sprintf("malformed report option '%s', format: type=path", report))
+		}
+
+		switch kind {
+		case "junit":
+			result = append(result, newJUnitReporter(path))
+		default:
+			return nil, models.NewErr(fmt.Sprintf("unknown report type '%s'", kind))
+		}
+	}
+
+	if err := ValidateOutput(ctx.OutputFlag()); err != nil {
+		return nil, err
+	}
+	if ctx.OutputFlag() == config.GithubOutput {
+		result = append(result, newGithubReporter(os.Stdout))
+	}
+
+	return result, nil
+}
+
+// ValidateOutput checks value of output flag of run and validate commands
+func ValidateOutput(output string) error {
+	switch output {
+	case "", config.TextOutput, config.GithubOutput:
+		return nil
+	default:
+		return models.NewErr(fmt.Sprintf("unknown output '%s', supported: %s, %s", output, config.TextOutput, config.GithubOutput))
+	}
+}
+
+func (r reporters) Report(report *models.Report) error {
+	for _, reporter := range r {
+		if err := reporter.Report(report); err != nil {
+			return errors.Wrap(err, "error writing report")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package logic_test
+
+import (
+	"flag"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/logic"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newReportContext(t *testing.T, reports ...string) config.ContextWrapper {
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.Var(cli.NewStringSlice(), "report", "")
+	for _, report := range reports {
+		if err := flagSet.Set("report", report); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return config.NewContextWrapper(cli.NewContext(nil, flagSet, nil))
+}
+
+func TestNewReporter_UnknownType(t *testing.T) {
+	_, err := logic.NewReporter(newReportContext(t, "html=report.html"))
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+}
+
+func TestValidateOutput(t *testing.T) {
+	assert.NoError(t, logic.ValidateOutput(""))
+	assert.NoError(t, logic.ValidateOutput(config.GithubOutput))
+	assert.ErrorAs(t, logic.ValidateOutput("bogus"), &models.UserErr{})
+}
+
+func TestJUnitReporter_Report(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.xml")
+	reporter, err := logic.NewReporter(newReportContext(t, "junit="+path))
+	assert.NoError(t, err)
+
+	report := models.NewReport()
+	report.Add(models.TestCaseResult{
+		Name:   "init",
+		Status: models.StatusPassed,
+		Steps:  []models.StepResult{{Name: "step 1", Service: "foo", Method: "Create", Duration: time.Millisecond}},
+	})
+	report.Add(models.TestCaseResult{
+		Name:   "bar",
+		Status: models.StatusFailed,
+		Steps: []models.StepResult{{
+			Name:    "setup step 1",
+			Service: "bar",
+			Method:  "GetBar",
+			Fails:   []models.ValidationFail{models.Fail(".total", "gt", 5, "3")},
+		}},
+	})
+	report.Add(models.TestCaseResult{Name: "baz", Status: models.StatusSkipped, Message: "failed dependency bar"})
+	report.Finish()
+
+	assert.NoError(t, reporter.Report(report))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `<testsuite name="grpc-fts" tests="3" failures="1" errors="0" skipped="1"`)
+	assert.Contains(t, string(content), `<testcase name="init" classname="grpc-fts"`)
+	assert.Contains(t, string(content), "setup step 1 (bar.GetBar, 0s):&#xA;  field: .total, function: gt, expected: 5, actual: 3")
+	assert.Contains(t, string(content), `<skipped message="failed dependency bar"></skipped>`)
+}
@@ -1,17 +1,24 @@
 package logic
 
 import (
+	"cmp"
+	"encoding/base64"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/res-am/grpc-fts/internal/config"
 	"github.com/res-am/grpc-fts/internal/models"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"math"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
 var ErrValidationFailed = errors.New("validation failed")
+var errFieldNotFound = errors.New("is not function, neither field")
 var statusOk = codes.OK.String()
 
 type function struct {
@@ -21,65 +28,87 @@ type function struct {
 
 type responseChecker struct {
 	functions map[string]function
-	variables Variables
+	variables *Variables
+	// stored collects values of store function during a single check
+	stored map[string]any
 }
 
-func NewResponseChecker(variables Variables) ResponseChecker {
-	validator := &responseChecker{variables: variables}
+func NewResponseChecker(variables *Variables) ResponseChecker {
+	checker := &responseChecker{variables: variables}
+	checker.functions = checker.buildFunctions()
+
+	return checker
+}
+
+// session returns checker which collects stored values to the given map instead of applying them,
+// so the caller decides whether they should be applied
+func (c *responseChecker) session(stored map[string]any) *responseChecker {
+	session := &responseChecker{variables: c.variables, stored: stored}
+	session.functions = session.buildFunctions()
+
+	return session
+}
+
+func (c *responseChecker) buildFunctions() map[string]function {
 	numericTypes := []reflect.Kind{
 		reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8,
-		reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint64,
 	}
-	scalarTypes := append(numericTypes, reflect.String) //nolint:gocritic
+	// typed values (enums, timestamps, durations) are structs
+	orderedTypes := append(numericTypes, reflect.Struct) //nolint:gocritic
+	scalarTypes := append(orderedTypes, reflect.String)  //nolint:gocritic
 
-	validator.functions = map[string]function{
+	return map[string]function{
 		"len": {
-			action:         validator.lenCheck,
+			action:         c.lenCheck,
 			supportedTypes: []reflect.Kind{reflect.Slice},
 		},
 		"gt": {
-			action:         validator.gtCheck,
-			supportedTypes: numericTypes,
+			action:         c.gtCheck,
+			supportedTypes: orderedTypes,
 		},
 		"gte": {
-			action:         validator.gteCheck,
-			supportedTypes: numericTypes,
+			action:         c.gteCheck,
+			supportedTypes: orderedTypes,
 		},
 		"lt": {
-			action:         validator.ltCheck,
-			supportedTypes: numericTypes,
+			action:         c.ltCheck,
+			supportedTypes: orderedTypes,
 		},
 		"lte": {
-			action:         validator.lteCheck,
-			supportedTypes: numericTypes,
+			action:         c.lteCheck,
+			supportedTypes: orderedTypes,
+		},
+		"within": {
+			action:         c.withinCheck,
+			supportedTypes: []reflect.Kind{reflect.Struct},
 		},
 		"one_of": {
-			action:         validator.oneOfCheck,
+			action:         c.oneOfCheck,
 			supportedTypes: append(scalarTypes, reflect.Map),
 		},
 		"any": {
-			action:         validator.anyCheck,
+			action:         c.anyCheck,
 			supportedTypes: []reflect.Kind{reflect.Slice},
 		},
 		"first": {
-			action:         validator.firstCheck,
+			action:         c.firstCheck,
 			supportedTypes: []reflect.Kind{reflect.Slice},
 		},
 		"all": {
-			action:         validator.allCheck,
+			action:         c.allCheck,
 			supportedTypes: []reflect.Kind{reflect.Slice},
 		},
+		// kinds are copied, so appended ones don't overwrite kinds of other functions sharing the array
 		"store": {
-			action:         validator.store,
-			supportedTypes: scalarTypes,
+			action:         c.store,
+			supportedTypes: append(append([]reflect.Kind{}, scalarTypes...), reflect.Bool, reflect.Map, reflect.Slice),
 		},
 		"not": {
-			action:         validator.notCheck,
+			action:         c.notCheck,
 			supportedTypes: append(scalarTypes, reflect.Map, reflect.Slice),
 		},
 	}
-
-	return validator
 }
 
 func (c *responseChecker) FunctionExists(function string) bool {
@@ -103,25 +132,104 @@ func (c *responseChecker) executeFunction(function string, expectation any, val
 	return false, fmt.Errorf("unsupported type %s for function %s", val.Kind(), function)
 }
 
-func (c *responseChecker) CheckResponse(response map[string]interface{}, expectations map[string]any) ([]models.ValidationFail, error) {
-	return c.checkObject("", expectations, reflect.ValueOf(response))
+// CheckResponse checks the response, descriptor of the response message is used to compare values
+// by their proto types, like 64-bit integers, enums, timestamps and durations. Descriptor can be nil.
+func (c *responseChecker) CheckResponse(
+	response map[string]interface{}, descriptor protoreflect.MessageDescriptor,
+	expectations map[string]any, stored map[string]any,
+) ([]models.ValidationFail, error) {
+	if descriptor != nil && response != nil {
+		response = typedMessage(response, descriptor)
+	}
+
+	return c.session(stored).checkObject("", expectations, reflect.ValueOf(response))
 }
 
-func (c *responseChecker) CheckStatus(actual *status.Status, expectation *config.Status) ([]models.ValidationFail, error) {
+// CheckMetadata checks headers or trailers, name is used as a path prefix of fails.
+// Key with a single value is checked as a string, with several values as an array of strings.
+// Values of binary keys (-bin suffix) are base64 encoded.
+func (c *responseChecker) CheckMetadata(
+	name string, md metadata.MD, expectations map[string]any, stored map[string]any,
+) ([]models.ValidationFail, error) {
+	actual := make(map[string]any, md.Len())
+	for key, values := range md {
+		items := make([]any, 0, len(values))
+		for _, value := range values {
+			if strings.HasSuffix(key, "-bin") {
+				value = base64.StdEncoding.EncodeToString([]byte(value))
+			}
+			items = append(items, value)
+		}
+
+		if len(items) == 1 {
+			actual[key] = items[0]
+		} else {
+			actual[key] = items
+		}
+	}
+
+	fails := make([]models.ValidationFail, 0)
+	present := make(map[string]any, len(expectations))
+	for key, expectation := range expectations {
+		_, isFunction := c.functions[key]
+		if _, ok := actual[strings.ToLower(key)]; !ok && !isFunction {
+			fails = append(fails, models.Fail(name+"."+key, "exists", expectation, "nil"))
+
+			continue
+		}
+
+		if isFunction {
+			present[key] = expectation
+		} else {
+			present[strings.ToLower(key)] = expectation
+		}
+	}
+
+	checkFails, err := c.session(stored).checkObject(name, present, reflect.ValueOf(actual))
+	if err != nil && !errors.Is(err, ErrValidationFailed) {
+		return nil, err
+	}
+
+	fails = append(fails, checkFails...)
+	if len(fails) > 0 {
+		return fails, ErrValidationFailed
+	}
+
+	return nil, nil
+}
+
+func (c *responseChecker) CheckStatus(
+	actual *status.Status, details []any, expectation *config.Status, stored map[string]any,
+) ([]models.ValidationFail, error) {
 	if actual == nil && expectation == nil {
 		return nil, nil
 	}
 	if expectation == nil {
-		expectation = &config.Status{Code: &statusOk, Message: new(string)}
+		expectation = &config.Status{Code: statusOk, Message: ""}
 	}
 
 	fails := make([]models.ValidationFail, 0)
-	if expectation.Code != nil && !strings.EqualFold(*expectation.Code, actual.Code().String()) {
-		fails = append(fails, models.Fail("response.status.code", "", *expectation.Code, actual.Code().String()))
-	}
-	if expectation.Message != nil && *expectation.Message != actual.Message() {
-		fails = append(fails, models.Fail("response.status.message", "", *expectation.Message, actual.Message()))
+	checks := []struct {
+		path        string
+		expectation any
+		actual      any
+	}{
+		{"response.status.code", normalizeCode(expectation.Code), actual.Code().String()},
+		{"response.status.message", expectation.Message, actual.Message()},
+		{"response.status.details", expectation.Details, details},
+	}
+	for _, check := range checks {
+		if check.expectation == nil {
+			continue
+		}
+
+		checkFails, err := c.session(stored).checkValue(check.path, check.expectation, reflect.ValueOf(check.actual))
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return nil, errors.Wrapf(err, "error validating %s", check.path)
+		}
+		fails = append(fails, checkFails...)
 	}
+
 	if len(fails) > 0 {
 		return fails, ErrValidationFailed
 	}
@@ -141,16 +249,16 @@ func (c *responseChecker) checkObject(path string, expectations map[string]any,
 
 	fails := make([]models.ValidationFail, 0)
 	for field, expectation := range expectations {
-		path = path + "." + field
+		fieldPath := path + "." + field
 		if _, ok := c.functions[field]; ok {
-			fail, err := c.checkFunction(path, field, expectation, object)
+			fail, err := c.checkFunction(fieldPath, field, expectation, object)
 			if errors.Is(err, ErrValidationFailed) {
 				fails = append(fails, fail)
 
 				continue
 			}
 			if err != nil {
-				return nil, errors.Wrapf(err, "error validating %s", path)
+				return nil, errors.Wrapf(err, "error validating %s", fieldPath)
 			}
 
 			continue
@@ -158,10 +266,10 @@ func (c *responseChecker) checkObject(path string, expectations map[string]any,
 
 		val := ExtractValueByField(object, field)
 		if !val.IsValid() {
-			return nil, fmt.Errorf("field %s is not function, neither field", field)
+			return nil, fmt.Errorf("field %s %w", field, errFieldNotFound)
 		}
 		val = val.Elem()
-		embeddedFails, err := c.checkValue(path, expectation, val)
+		embeddedFails, err := c.checkValue(fieldPath, expectation, val)
 		if err != nil {
 			if errors.Is(err, ErrValidationFailed) {
 				fails = append(fails, embeddedFails...)
@@ -169,7 +277,7 @@ func (c *responseChecker) checkObject(path string, expectations map[string]any,
 				continue
 			}
 
-			return nil, errors.Wrapf(err, "error validating %s", path)
+			return nil, errors.Wrapf(err, "error validating %s", fieldPath)
 		}
 	}
 
@@ -298,42 +406,75 @@ func (c *responseChecker) lenCheck(expectation any, val reflect.Value) (bool, er
 	}
 }
 
-func (c *responseChecker) float64Check(check func(float64) bool, val reflect.Value) (bool, error) {
+// compare returns -1, 0 or +1 if the value is less, equal or greater than the expectation
+func (c *responseChecker) compare(expectation any, val reflect.Value) (int, error) {
+	if typed, ok := val.Interface().(typedValue); ok {
+		return typed.compare(expectation)
+	}
+
+	expected, ok := expectation.(float64)
+	if !ok {
+		return 0, fmt.Errorf("numeric expectation was expected, got %v", expectation)
+	}
+
 	var f float64
 	switch val.Kind() { //nolint:exhaustive
 	case reflect.Float32, reflect.Float64:
 		f = val.Float()
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		f = float64(val.Int())
+	case reflect.Uint64:
+		f = float64(val.Uint())
 	default:
-		return false, fmt.Errorf("numeric type was expected, got %s", val.Kind())
+		return 0, fmt.Errorf("numeric type was expected, got %s", val.Kind())
 	}
 
-	return check(f), nil
+	return cmp.Compare(f, expected), nil
 }
 
 func (c *responseChecker) gtCheck(expectation any, val reflect.Value) (bool, error) {
-	return c.float64Check(func(f float64) bool {
-		return f > expectation.(float64)
-	}, val)
+	result, err := c.compare(expectation, val)
+
+	return result > 0, err
 }
 
 func (c *responseChecker) gteCheck(expectation any, val reflect.Value) (bool, error) {
-	return c.float64Check(func(f float64) bool {
-		return f >= expectation.(float64)
-	}, val)
+	result, err := c.compare(expectation, val)
+
+	return result >= 0, err
 }
 
 func (c *responseChecker) ltCheck(expectation any, val reflect.Value) (bool, error) {
-	return c.float64Check(func(f float64) bool {
-		return f < expectation.(float64)
-	}, val)
+	result, err := c.compare(expectation, val)
+
+	return result < 0, err
 }
 
 func (c *responseChecker) lteCheck(expectation any, val reflect.Value) (bool, error) {
-	return c.float64Check(func(f float64) bool {
-		return f <= expectation.(float64)
-	}, val)
+	result, err := c.compare(expectation, val)
+
+	return result <= 0, err
+}
+
+// withinCheck checks that timestamp or duration differs from the reference not more than by tolerance,
+// expectation is written as `5m of now` or `1s of 2024-01-02T15:04:05Z`
+func (c *responseChecker) withinCheck(expectation any, val reflect.Value) (bool, error) {
+	typed, ok := val.Interface().(temporalValue)
+	if !ok {
+		return false, errors.New("timestamp or duration was expected")
+	}
+
+	tolerance, reference, err := parseWithin(expectation)
+	if err != nil {
+		return false, err
+	}
+
+	offset, err := typed.offset(reference)
+	if err != nil {
+		return false, err
+	}
+
+	return offset.Abs() <= tolerance, nil
 }
 
 func (c *responseChecker) oneOfCheck(expectation any, val reflect.Value) (bool, error) {
@@ -351,9 +492,16 @@ func (c *responseChecker) oneOfCheck(expectation any, val reflect.Value) (bool,
 	return false, nil
 }
 
+// anyCheck skips elements of other types than `@type` of the expectation, so status details
+// of different types can be matched
 func (c *responseChecker) anyCheck(expectation any, val reflect.Value) (bool, error) {
 	for i := 0; i < val.Len(); i++ {
-		fails, err := c.checkValue("", expectation, val.Index(i).Elem())
+		element := val.Index(i).Elem()
+		if !typeMatches(expectation, element) {
+			continue
+		}
+
+		fails, err := c.checkValue("", expectation, element)
 		if err != nil && !errors.Is(err, ErrValidationFailed) {
 			return false, errors.Wrapf(err, "error checking `any`, index %d", i)
 		}
@@ -366,6 +514,27 @@ func (c *responseChecker) anyCheck(expectation any, val reflect.Value) (bool, er
 	return false, nil
 }
 
+// typeMatches reports whether the element has the type url of the expectation, expectation without
+// `@type` key matches any element
+func typeMatches(expectation any, element reflect.Value) bool {
+	expected, ok := expectation.(map[string]any)
+	if !ok {
+		return true
+	}
+	typeURL, ok := expected["@type"].(string)
+	if !ok {
+		return true
+	}
+
+	actual := ExtractValueByField(element, "@type")
+	if !actual.IsValid() {
+		return false
+	}
+	actualURL, ok := actual.Interface().(string)
+
+	return ok && actualURL == typeURL
+}
+
 func (c *responseChecker) firstCheck(expectation any, val reflect.Value) (bool, error) {
 	if val.Len() == 0 {
 		return false, errors.New("array is empty")
@@ -404,21 +573,57 @@ func (c *responseChecker) store(variable any, val reflect.Value) (bool, error) {
 		return false, errors.New("variable name was expected")
 	}
 
-	c.variables[variableName] = fmt.Sprintf("%v", val.Interface())
+	c.stored[variableName] = plainValue(val.Interface())
 
 	return true, nil
 }
 
 func (c *responseChecker) equalCheck(expectation any, val reflect.Value) (bool, error) {
+	if typed, ok := val.Interface().(typedValue); ok {
+		return typed.equal(expectation)
+	}
+
 	switch val.Kind() { //nolint:exhaustive
 	case reflect.Float32, reflect.Float64:
-		return expectation.(float64) == val.Float(), nil
+		expected, ok := expectation.(float64)
+		if !ok {
+			return false, fmt.Errorf("number was expected, got %v", expectation)
+		}
+
+		return expected == val.Float(), nil
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return expectation.(float64) == float64(val.Int()), nil
+		// 64-bit integers can be written as strings to keep precision
+		switch expected := expectation.(type) {
+		case string:
+			return expected == strconv.FormatInt(val.Int(), 10), nil
+		case float64:
+			return expected == float64(val.Int()), nil
+		default:
+			return false, fmt.Errorf("number was expected, got %v", expectation)
+		}
+	case reflect.Uint64:
+		switch expected := expectation.(type) {
+		case string:
+			return expected == strconv.FormatUint(val.Uint(), 10), nil
+		case float64:
+			return expected == float64(val.Uint()), nil
+		default:
+			return false, fmt.Errorf("number was expected, got %v", expectation)
+		}
 	case reflect.String:
-		return expectation.(string) == val.String(), nil
+		expected, ok := expectation.(string)
+		if !ok {
+			return false, fmt.Errorf("string was expected, got %v", expectation)
+		}
+
+		return expected == val.String(), nil
 	case reflect.Bool:
-		return expectation.(bool) == val.Bool(), nil
+		expected, ok := expectation.(bool)
+		if !ok {
+			return false, fmt.Errorf("boolean was expected, got %v", expectation)
+		}
+
+		return expected == val.Bool(), nil
 	default:
 		return false, fmt.Errorf("unsopported type %s", val.Kind())
 	}
@@ -433,6 +638,73 @@ func (c *responseChecker) notCheck(expectation any, val reflect.Value) (bool, er
 	return len(fails) != 0, nil
 }
 
+// codeMatches compares status code ignoring case and underscores, so both NOT_FOUND and NotFound are accepted
+func codeMatches(expected string, actual codes.Code) bool {
+	return strings.EqualFold(strings.ReplaceAll(expected, "_", ""), actual.String())
+}
+
+// parseCode finds status code by name, both NOT_FOUND and NotFound are accepted
+func parseCode(name string) (codes.Code, bool) {
+	for code := codes.OK; code <= codes.Unauthenticated; code++ {
+		if codeMatches(name, code) {
+			return code, true
+		}
+	}
+
+	return codes.Unknown, false
+}
+
+// numericCode finds status code by its number, like 5 for NOT_FOUND
+func numericCode(value float64) (codes.Code, bool) {
+	if value != math.Trunc(value) || value < float64(codes.OK) || value > float64(codes.Unauthenticated) {
+		return codes.Unknown, false
+	}
+
+	return codes.Code(value), true
+}
+
+// normalizeCode brings status codes of the expectation to the form of codes.Code.String(), like NotFound,
+// so they're compared with the actual code. Numeric codes are replaced with their names, names of variables
+// of store function and unknown codes are kept as is.
+func normalizeCode(expectation any) any {
+	switch t := expectation.(type) {
+	case string:
+		if code, ok := parseCode(t); ok {
+			return code.String()
+		}
+
+		return expectation
+	case float64:
+		if code, ok := numericCode(t); ok {
+			return code.String()
+		}
+
+		return expectation
+	case []any:
+		result := make([]any, 0, len(t))
+		for _, item := range t {
+			result = append(result, normalizeCode(item))
+		}
+
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(t))
+		for key, item := range t {
+			if key == "store" {
+				result[key] = item
+
+				continue
+			}
+
+			result[key] = normalizeCode(item)
+		}
+
+		return result
+	default:
+		return expectation
+	}
+}
+
 func isSlice(val reflect.Value) bool {
 	return val.Kind() == reflect.Slice
 }
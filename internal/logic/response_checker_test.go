@@ -0,0 +1,205 @@
+package logic_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bufbuild/protocompile"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/logic"
+	"github.com/res-am/grpc-fts/internal/proto"
+	grpc_fts "github.com/res-am/grpc-fts/internal/proto/test_data"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"testing"
+	"time"
+)
+
+const typedProto = `
+syntax = "proto3";
+package typed;
+import "google/protobuf/timestamp.proto";
+import "google/protobuf/duration.proto";
+
+enum State {
+  STATE_UNSPECIFIED = 0;
+  STATE_ACTIVE = 1;
+  STATE_DELETED = 2;
+}
+
+message Item {
+  int64 total = 1;
+  uint64 size = 2;
+  State state = 3;
+  google.protobuf.Timestamp created_at = 4;
+  google.protobuf.Duration ttl = 5;
+  repeated Item children = 6;
+}
+`
+
+func newChecker(t *testing.T) logic.ResponseChecker {
+	variables, err := logic.NewVariables(newRunContext(t))
+	assert.NoError(t, err)
+
+	return logic.NewResponseChecker(variables)
+}
+
+func typedDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	c := &protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{"typed.proto": typedProto}),
+		}),
+	}
+	compiled, err := c.Compile(context.Background(), "typed.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return compiled[0].Messages().ByName("Item")
+}
+
+func parseJSON(t *testing.T, raw string) map[string]any {
+	var result map[string]any
+	if err := json.Unmarshal([]byte(raw), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func parseStatus(t *testing.T, raw string) *config.Status {
+	var expectation config.Status
+	if err := json.Unmarshal([]byte(raw), &expectation); err != nil {
+		t.Fatal(err)
+	}
+
+	return &expectation
+}
+
+func TestResponseChecker_CheckStatus_Details(t *testing.T) {
+	st, err := status.New(codes.InvalidArgument, "quota exceeded").WithDetails(
+		&errdetails.ErrorInfo{Reason: "QUOTA_EXCEEDED", Domain: "example.com"},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: "name"}}},
+	)
+	assert.NoError(t, err)
+
+	message := dynamicpb.NewMessage((&grpc_fts.TestMessage{}).ProtoReflect().Descriptor())
+	response, err := proto.NewGRPCUnaryResponse(nil, message, nil, nil, st.Err())
+	assert.NoError(t, err)
+
+	checker := newChecker(t)
+	fails, err := checker.CheckStatus(response.Status, response.StatusDetails, parseStatus(t, `{
+		"code": {"one_of": ["NOT_FOUND", "INVALID_ARGUMENT"]},
+		"message": {"not": "internal error"},
+		"details": {
+			"len": 2,
+			"any": {"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "QUOTA_EXCEEDED"}
+		}
+	}`), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, fails)
+
+	fails, err = checker.CheckStatus(response.Status, response.StatusDetails, parseStatus(t, `{
+		"code": "InvalidArgument",
+		"details": {"any": {"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": "OTHER"}}
+	}`), nil)
+	assert.ErrorIs(t, err, logic.ErrValidationFailed)
+	assert.Len(t, fails, 1)
+	assert.Equal(t, "response.status.details.any", fails[0].Field)
+}
+
+func TestResponseChecker_CheckStatus_NumericCode(t *testing.T) {
+	checker := newChecker(t)
+	fails, err := checker.CheckStatus(status.New(codes.NotFound, "not found"), nil, parseStatus(t, `{
+		"code": {"one_of": [5, 9]}
+	}`), nil)
+	assert.NoError(t, err)
+	assert.Empty(t, fails)
+
+	fails, err = checker.CheckStatus(status.New(codes.NotFound, "not found"), nil, parseStatus(t, `{"code": 3}`), nil)
+	assert.ErrorIs(t, err, logic.ErrValidationFailed)
+	assert.Len(t, fails, 1)
+
+	_, err = checker.CheckStatus(status.New(codes.NotFound, "not found"), nil, parseStatus(t, `{"code": true}`), nil)
+	assert.ErrorContains(t, err, "string was expected, got true")
+}
+
+func TestResponseChecker_CheckStatus_StoreCode(t *testing.T) {
+	stored := make(map[string]any)
+	fails, err := newChecker(t).CheckStatus(status.New(codes.NotFound, "not found"), nil, parseStatus(t, `{
+		"code": {"store": "myCode", "not": "ALREADY_EXISTS"}
+	}`), stored)
+
+	assert.NoError(t, err)
+	assert.Empty(t, fails)
+	assert.Equal(t, map[string]any{"myCode": "NotFound"}, stored)
+}
+
+func TestResponseChecker_CheckResponse_Typed(t *testing.T) {
+	created := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339Nano)
+	response := parseJSON(t, `{
+		"total": "9007199254740993",
+		"size": "18446744073709551615",
+		"state": "STATE_ACTIVE",
+		"createdAt": "`+created+`",
+		"ttl": "1.5s",
+		"children": [{"total": "8", "state": "STATE_DELETED"}]
+	}`)
+
+	checker := newChecker(t)
+	stored := make(map[string]any)
+	fails, err := checker.CheckResponse(response, typedDescriptor(t), parseJSON(t, `{
+		"total": {"gt": 1000, "store": "total"},
+		"size": {"gte": 1},
+		"state": {"one_of": [1, "STATE_DELETED"], "lt": "STATE_DELETED"},
+		"createdAt": {"within": "5m of now", "lt": "now"},
+		"ttl": {"gt": "1s", "lte": "1500ms"},
+		"children": {"first": {"total": 8, "state": 2}}
+	}`), stored)
+	assert.NoError(t, err)
+	assert.Empty(t, fails)
+	assert.Equal(t, int64(9007199254740993), stored["total"])
+
+	fails, err = checker.CheckResponse(response, typedDescriptor(t), parseJSON(t, `{
+		"total": "9007199254740992",
+		"createdAt": {"within": "10s of now"},
+		"state": "STATE_UNSPECIFIED"
+	}`), stored)
+	assert.ErrorIs(t, err, logic.ErrValidationFailed)
+	assert.Len(t, fails, 3)
+}
+
+func TestResponseChecker_CheckResponse_AnyUnknownField(t *testing.T) {
+	response := parseJSON(t, `{"children": [{"total": "8"}]}`)
+
+	_, err := newChecker(t).CheckResponse(response, nil, parseJSON(t, `{
+		"children": {"any": {"totl": "8"}}
+	}`), nil)
+	assert.ErrorContains(t, err, "field totl is not function, neither field")
+}
+
+func TestResponseChecker_CheckResponse_StoreStructured(t *testing.T) {
+	response := parseJSON(t, `{
+		"user": {"id": 7, "addresses": [{"id": "a1"}]},
+		"active": true,
+		"children": [{"total": "8", "state": "STATE_DELETED"}]
+	}`)
+
+	stored := make(map[string]any)
+	fails, err := newChecker(t).CheckResponse(response, typedDescriptor(t), parseJSON(t, `{
+		"user": {"store": "user"},
+		"active": {"store": "active"},
+		"children": {"store": "children"}
+	}`), stored)
+
+	assert.NoError(t, err)
+	assert.Empty(t, fails)
+	assert.Equal(t, map[string]any{
+		"user":     map[string]any{"id": float64(7), "addresses": []any{map[string]any{"id": "a1"}}},
+		"active":   true,
+		"children": []any{map[string]any{"total": int64(8), "state": "STATE_DELETED"}},
+	}, stored)
+}
@@ -0,0 +1,83 @@
+package logic
+
+import (
+	"github.com/res-am/grpc-fts/internal/config"
+	"google.golang.org/grpc/codes"
+	"time"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryInterval = 200 * time.Millisecond
+)
+
+type retryPolicy struct {
+	attempts int
+	interval time.Duration
+	backoff  float64
+	deadline time.Time
+	codes    []string
+}
+
+// newRetryPolicy builds policy of the step, without retry block the step is invoked once.
+// If only timeout is set, attempts are not limited.
+func newRetryPolicy(cfg *config.Retry, started time.Time) retryPolicy {
+	if cfg == nil {
+		return retryPolicy{attempts: 1}
+	}
+
+	policy := retryPolicy{
+		attempts: cfg.Attempts,
+		interval: time.Duration(cfg.Interval),
+		backoff:  cfg.Backoff,
+		codes:    cfg.OnCodes,
+	}
+	if policy.interval == 0 {
+		policy.interval = defaultRetryInterval
+	}
+	if policy.backoff < 1 {
+		policy.backoff = 1
+	}
+	if cfg.Timeout > 0 {
+		policy.deadline = started.Add(time.Duration(cfg.Timeout))
+	}
+	if policy.attempts == 0 && policy.deadline.IsZero() {
+		policy.attempts = defaultRetryAttempts
+	}
+
+	return policy
+}
+
+// next returns delay before the next attempt, false means there should be no more attempts
+func (p retryPolicy) next(attempt int, code codes.Code) (time.Duration, bool) {
+	if p.attempts > 0 && attempt >= p.attempts {
+		return 0, false
+	}
+	if !p.retryableCode(code) {
+		return 0, false
+	}
+
+	delay := p.interval
+	for i := 1; i < attempt; i++ {
+		delay = time.Duration(float64(delay) * p.backoff)
+	}
+	if !p.deadline.IsZero() && time.Now().Add(delay).After(p.deadline) {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+func (p retryPolicy) retryableCode(code codes.Code) bool {
+	if len(p.codes) == 0 {
+		return true
+	}
+
+	for _, expected := range p.codes {
+		if codeMatches(expected, code) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,139 +2,425 @@ package logic
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/res-am/grpc-fts/internal/config"
 	"github.com/res-am/grpc-fts/internal/models"
 	"github.com/res-am/grpc-fts/internal/proto"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"io"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
+// globalSteps names setup and teardown steps of global.yaml in errors and snapshots
+const globalSteps = "global"
+
 type runner struct {
 	testCases config.TestCases
 	clients   proto.ClientsManager
 	logger    *logrus.Entry
 	checker   ResponseChecker
-	variables Variables
+	variables *Variables
+	reporter  Reporter
+	global    *config.Global
+	failFast  bool
+	parallel  int
+	// snapshots is a directory of snapshot files
+	snapshots       string
+	updateSnapshots bool
 }
 
-func NewRunner(testCases config.TestCases, clients proto.ClientsManager, logger *logrus.Entry, validator ResponseChecker, variables Variables) Runner {
-	return &runner{testCases: testCases, clients: clients, logger: logger, checker: validator, variables: variables}
+func NewRunner(
+	ctx config.ContextWrapper, testCases config.TestCases, clients proto.ClientsManager, logger *logrus.Entry,
+	validator ResponseChecker, variables *Variables, reporter Reporter, global *config.Global,
+) Runner {
+	return &runner{
+		testCases: testCases, clients: clients, logger: logger, checker: validator, variables: variables, reporter: reporter,
+		global:   global,
+		failFast: ctx.FailFastFlag(), parallel: max(ctx.ParallelFlag(), 1),
+		snapshots: filepath.Join(ctx.ConfigFlag(), "test-cases", snapshotsDir), updateSnapshots: ctx.UpdateSnapshotsFlag(),
+	}
 }
 
-func (r *runner) RunTestCases() (err error) {
-	failedTestCases := make(failedDependencies)
-TestCaseLoop:
-	for _, testCase := range r.testCases {
-		if failed, dependency := failedTestCases.HasDependencyFailed(testCase.DependsOn); failed {
-			r.logger.Infof("test case %s skipped due to failed dependency %s", testCase.Name, dependency)
-			failedTestCases.Add(testCase.Name)
+func (r *runner) RunTestCases() error {
+	report := models.NewReport()
+	if len(r.global.Setup) > 0 {
+		report.Setup = r.runGlobalSetup()
+	}
+	if report.Setup.Failed() {
+		r.logger.Errorf("global setup failed: %s", report.Setup.Message)
+		for _, testCase := range r.testCases {
+			report.Add(models.TestCaseResult{Name: testCase.Name, Status: models.StatusErrored, Message: "global setup failed"})
+		}
+	} else {
+		r.runTestCases(report)
+	}
+	if len(r.global.Teardown) > 0 {
+		report.Teardown = r.runTeardown(globalSteps, "global teardown step", r.global.Teardown, r.logger)
+	}
+	report.Finish()
+	r.summary(report)
 
-			continue
+	if err := r.reporter.Report(report); err != nil {
+		return err
+	}
+
+	if report.Setup.Failed() {
+		return models.NewErr("global setup failed: " + report.Setup.Message)
+	}
+	failed := report.Count(models.StatusFailed) + report.Count(models.StatusErrored)
+	if failed > 0 {
+		return models.NewErr(fmt.Sprintf("%d of %d test cases failed", failed, len(report.TestCases)))
+	}
+	if teardowns := report.TeardownFailures(); teardowns > 0 {
+		return models.NewErr(fmt.Sprintf("teardown of %d test cases failed", teardowns))
+	}
+	if report.Teardown.Failed() {
+		return models.NewErr("global teardown failed: " + report.Teardown.Message)
+	}
+
+	return nil
+}
+
+func (r *runner) summary(report *models.Report) {
+	r.logger.WithFields(logrus.Fields{
+		"passed":          report.Count(models.StatusPassed),
+		"failed":          report.Count(models.StatusFailed),
+		"skipped":         report.Count(models.StatusSkipped),
+		"errored":         report.Count(models.StatusErrored),
+		"teardown_failed": report.TeardownFailures(),
+		"duration":        report.Duration,
+	}).Infof("run finished, %d test cases in total", len(report.TestCases))
+}
+
+// runTestCase runs setup steps and steps until the first fail, teardown steps are run in any case.
+// Test case has its own scope of variables, outputs of passed test case are exported from it.
+func (r *runner) runTestCase(testCase config.TestCase, logger *logrus.Entry) (models.TestCaseResult, error) {
+	r = r.withVariables(testCase.Variables)
+
+	started := time.Now()
+	result := models.TestCaseResult{
+		Name:   testCase.Name,
+		Status: models.StatusPassed,
+		Steps:  make([]models.StepResult, 0, len(testCase.Setup)+len(testCase.Steps)),
+	}
+
+	err := r.runSteps(testCase.Name, "setup step", testCase.Setup, &result, logger)
+	if err == nil && result.Status == models.StatusPassed {
+		// steps are indexed after setup steps, so their snapshots don't overlap
+		err = r.runSteps(testCase.Name, "step", testCase.Steps, &result, logger)
+	}
+	if err == nil && result.Status == models.StatusPassed {
+		if err = r.variables.Export(testCase.Name, testCase.Outputs); err != nil {
+			result.Status = models.StatusErrored
+			result.Message = err.Error()
 		}
+	}
+	if len(testCase.Teardown) > 0 {
+		result.Teardown = r.runTeardown(testCase.Name, "teardown step", testCase.Teardown, logger)
+	}
+	result.Duration = time.Since(started)
 
-		for i, step := range testCase.Steps {
-			md, request, err := r.prepareRequest(step.Metadata, step.Service.Metadata, step.Request)
-			if err != nil {
-				return errors.Wrapf(err, "for step %d of test case %s", i+1, testCase.Name)
-			}
+	return result, err
+}
 
-			client := r.clients.GetClient(step.ServiceName)
-			response, err := client.Invoke(step.BuildProtoFullName(), request, metadata.New(md))
-			if err != nil {
-				return errors.Wrapf(err, "error on calling service %s", step.ServiceName)
-			}
+// withVariables returns a copy of the runner which resolves the given variables before the shared ones
+func (r *runner) withVariables(values map[string]any) *runner {
+	scoped := *r
+	scoped.variables = r.variables.With(values)
 
-			expectedResponse, err := r.prepareResponse(step.Response)
-			if err != nil {
-				return errors.Wrapf(err, "error on preparing expected response for step %d of test case %s", i, testCase.Name)
-			}
+	return &scoped
+}
 
-			fails, err := r.check(step.Status, expectedResponse, response)
-			if errors.Is(err, ErrValidationFailed) {
-				failedTestCases.Add(testCase.Name)
-				r.failed(fails, testCase.Name, i)
+// runSteps runs steps until the first fail. Kind names the steps, like "setup step", they're numbered from 1.
+func (r *runner) runSteps(
+	testCase, kind string, steps []config.Step, result *models.TestCaseResult, logger *logrus.Entry,
+) error {
+	for i, step := range steps {
+		name := fmt.Sprintf("%s %d", kind, i+1)
+		stepResult, err := r.runStep(snapshotName(testCase, kind, i), step)
+		stepResult.Name = name
+		result.Steps = append(result.Steps, stepResult)
+		if errors.Is(err, ErrValidationFailed) {
+			result.Status = models.StatusFailed
+			r.failed(logger, stepResult.Fails, stepTitle(testCase, name))
 
-				break TestCaseLoop
-			}
-			if err != nil {
-				return errors.Wrapf(err, "response validation error")
-			}
+			return nil
 		}
+		if err != nil {
+			err = errors.Wrap(err, name)
+			result.Status = models.StatusErrored
+			result.Message = err.Error()
 
-		r.logger.Infof("test case %s was finished successfully", testCase.Name)
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (r *runner) check(expectedStatus *config.Status, expectedResponse map[string]any, response *proto.GRPCResponse) ([]models.ValidationFail, error) {
-	if !response.IsStream {
-		statusFails, err := r.checker.CheckStatus(response.Status, expectedStatus)
-		if err != nil {
-			return statusFails, err
-		}
+// snapshotName names snapshot of the step, like "get_user.2" for steps and "get_user.setup.1" for setup steps,
+// so snapshots of steps are kept when setup steps are added or removed
+func snapshotName(testCase, kind string, i int) string {
+	phase := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(kind, "global "), "step"))
+	if phase == "" {
+		return fmt.Sprintf("%s.%d", testCase, i+1)
+	}
+
+	return fmt.Sprintf("%s.%s.%d", testCase, phase, i+1)
+}
 
-		return r.checker.CheckResponse(response.Response, expectedResponse)
+// stepTitle names the step in logs, like "test case X, setup step 1", steps of global.yaml are named by themselves
+func stepTitle(testCase, name string) string {
+	if testCase == globalSteps {
+		return name
 	}
 
-	var expectedStream []interface{}
-	if expectedResponse != nil && expectedResponse["stream"] != nil {
-		switch v := expectedResponse["stream"].(type) {
-		case []interface{}:
-			expectedStream = v
+	return "test case " + testCase + ", " + name
+}
+
+// runGlobalSetup runs setup steps of global.yaml until the first fail
+func (r *runner) runGlobalSetup() *models.PhaseResult {
+	result := models.TestCaseResult{Status: models.StatusPassed}
+	err := r.runSteps(globalSteps, "global setup step", r.global.Setup, &result, r.logger)
+
+	phase := &models.PhaseResult{Steps: result.Steps}
+	switch {
+	case err != nil:
+		phase.Message = err.Error()
+	case result.Status != models.StatusPassed:
+		phase.Message = fmt.Sprintf("global setup step %d failed", len(result.Steps))
+	}
+
+	return phase
+}
+
+// runTeardown runs all teardown steps regardless of their results, so as much as possible is cleaned up.
+// Kind names the steps, like "teardown step", they're numbered from 1.
+func (r *runner) runTeardown(testCase, kind string, steps []config.Step, logger *logrus.Entry) *models.PhaseResult {
+	result := &models.PhaseResult{Steps: make([]models.StepResult, 0, len(steps))}
+	messages := make([]string, 0)
+	for i, step := range steps {
+		name := fmt.Sprintf("%s %d", kind, i+1)
+		stepResult, err := r.runStep(snapshotName(testCase, kind, i), step)
+		stepResult.Name = name
+		result.Steps = append(result.Steps, stepResult)
+		title := stepTitle(testCase, name)
+		switch {
+		case errors.Is(err, ErrValidationFailed):
+			r.failed(logger, stepResult.Fails, title)
+			messages = append(messages, title+" failed")
+		case err != nil:
+			logger.WithError(err).Warnf("%s finished with error", title)
+			messages = append(messages, title+": "+err.Error())
 		}
 	}
+	result.Message = strings.Join(messages, "; ")
 
-	for i := 0; ; i++ {
-		err := response.StreamReceive()
-		if errors.Is(err, io.EOF) {
-			return nil, nil
+	return result
+}
+
+// runStep runs the step with its retries, snapshot names the golden file of the step
+func (r *runner) runStep(snapshot string, step config.Step) (models.StepResult, error) {
+	started := time.Now()
+	retry := newRetryPolicy(step.Retry, started)
+	result := models.StepResult{Service: step.ServiceName, Method: step.Method, Position: step.Position()}
+
+	for {
+		result.Attempts++
+		stored := make(map[string]any)
+		fails, code, err := r.invokeStep(snapshot, step, stored)
+		if err == nil {
+			r.variables.SetAll(stored)
 		}
-		if err != nil {
-			return nil, errors.Wrap(err, "error on stream receiving")
+
+		delay, ok := retry.next(result.Attempts, code)
+		if !errors.Is(err, ErrValidationFailed) || !ok {
+			locateFails(step, fails)
+			result.Fails = fails
+			result.Duration = time.Since(started)
+			if err != nil && !errors.Is(err, ErrValidationFailed) && result.Position.IsKnown() {
+				err = errors.Wrap(err, result.Position.String())
+			}
+
+			return result, err
 		}
 
-		statusFails, err := r.checker.CheckStatus(response.Status, expectedStatus)
+		time.Sleep(delay)
+	}
+}
+
+// invokeStep makes a single call of the step and checks the response, values of store function are collected
+// to stored map. Returned status code is the actual code of the call.
+func (r *runner) invokeStep(snapshot string, step config.Step, stored map[string]any) ([]models.ValidationFail, codes.Code, error) {
+	if len(step.Conversation) > 0 {
+		return r.converse(step, stored)
+	}
+
+	response, err := r.call(step)
+	if err != nil {
+		return nil, codes.Unknown, err
+	}
+	defer response.Close()
+
+	expected, err := r.prepareExpectations(step)
+	if err != nil {
+		return nil, codes.Unknown, errors.Wrap(err, "error on preparing expectations")
+	}
+	expected.snapshot = newSnapshot(r.snapshots, snapshot, step.Snapshot, r.updateSnapshots)
+
+	fails, err := r.check(expected, response, stored)
+	if err != nil && !errors.Is(err, ErrValidationFailed) {
+		return nil, codes.Unknown, errors.Wrapf(err, "response validation error")
+	}
+
+	return fails, response.Status.Code(), err
+}
+
+// call sends the request of the step, the response should be closed by the caller
+func (r *runner) call(step config.Step) (*proto.GRPCResponse, error) {
+	md, request, err := r.prepareRequest(step.Metadata, step.Service.Metadata, step.Request)
+	if err != nil {
+		return nil, errors.Wrap(err, "error on preparing request")
+	}
+
+	client := r.clients.GetClient(step.ServiceName)
+	options := proto.InvokeOptions{SendDelay: time.Duration(step.SendDelay)}
+	response, err := client.Invoke(step.BuildProtoFullName(), request, metadata.New(md), options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error on calling service %s", step.ServiceName)
+	}
+
+	return response, nil
+}
+
+func (r *runner) check(expected expectations, response *proto.GRPCResponse, stored map[string]any) ([]models.ValidationFail, error) {
+	if !response.IsStream {
+		statusFails, err := r.checker.CheckStatus(response.Status, response.StatusDetails, expected.status, stored)
 		if err != nil {
 			return statusFails, err
 		}
 
-		var expectedStreamMessage map[string]any
-		if expectedStream != nil && len(expectedStream) > i {
-			switch v := expectedStream[i].(type) {
-			case map[string]any:
-				expectedStreamMessage = v
+		fails, err := r.checker.CheckResponse(response.Response, response.Descriptor(), expected.response, stored)
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return nil, err
+		}
+
+		if expected.snapshot != nil {
+			snapshotFails, err := expected.snapshot.check(response.Response)
+			if err != nil && !errors.Is(err, ErrValidationFailed) {
+				return nil, err
 			}
+			fails = append(fails, snapshotFails...)
+		}
+
+		return r.checkMetadata(fails, expected, response, stored)
+	}
+
+	return r.checkStream(expected, response, stored)
+}
+
+// checkMetadata checks headers and trailers, fails are appended to the given response fails
+func (r *runner) checkMetadata(
+	fails []models.ValidationFail, expected expectations, response *proto.GRPCResponse, stored map[string]any,
+) ([]models.ValidationFail, error) {
+	if expected.headers != nil {
+		headerFails, err := r.checker.CheckMetadata("headers", response.Header, expected.headers, stored)
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return nil, errors.Wrap(err, "error checking headers")
 		}
-		fails, err := r.checker.CheckResponse(response.Response, expectedStreamMessage)
+		fails = append(fails, headerFails...)
+	}
+
+	if expected.trailers != nil {
+		trailerFails, err := r.checker.CheckMetadata("trailers", response.Trailer, expected.trailers, stored)
 		if err != nil && !errors.Is(err, ErrValidationFailed) {
-			return nil, errors.Wrapf(err, "error checking stream message #%d", i)
+			return nil, errors.Wrap(err, "error checking trailers")
 		}
+		fails = append(fails, trailerFails...)
+	}
+
+	if len(fails) > 0 {
+		return fails, ErrValidationFailed
+	}
+
+	return nil, nil
+}
 
-		// successful exit
-		if len(fails) == 0 {
-			return nil, nil
+// drain reads the rest of the stream, so it's finished
+func (r *runner) drain(response *proto.GRPCResponse) error {
+	for {
+		err := response.StreamReceive()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "error on stream receiving")
 		}
 	}
 }
 
-func (r *runner) failed(fails []models.ValidationFail, testCase string, step int) {
-	entry := r.logger
+// failed logs fails of the step, title names the step, like "test case X, step 1"
+func (r *runner) failed(logger *logrus.Entry, fails []models.ValidationFail, title string) {
+	entry := logger
+	snapshotFails := make([]models.ValidationFail, 0)
 	for _, fail := range fails {
+		if fail.Function == snapshotFunction {
+			snapshotFails = append(snapshotFails, fail)
+
+			continue
+		}
+
 		entry = entry.WithFields(logrus.Fields{
+			"position": fail.Position.String(),
 			"field":    fail.Field,
 			"function": fail.Function,
 			"expected": fail.Expectation,
 			"actual":   fail.ActualValue,
 		})
 	}
-	entry.Warnf("test case %s, step %d finished with some fails", testCase, step+1)
+	entry.Warnf("%s finished with some fails", title)
+
+	if len(snapshotFails) > 0 {
+		logger.Warnf("%s response differs from snapshot:\n%s", title, snapshotDiff(snapshotFails))
+	}
+}
+
+// locateFails sets positions of expectations of the step to its fails
+func locateFails(step config.Step, fails []models.ValidationFail) {
+	for i := range fails {
+		fails[i].Position = step.Positions.Find(expectationPath(fails[i]))
+	}
+}
+
+// expectationPath returns path of the expectation of the fail in the step, like response.user.id.
+// Fields of fails are relative to the response, except status, metadata and conversation ones.
+func expectationPath(fail models.ValidationFail) string {
+	field := fail.Field
+	switch {
+	case fail.Function == snapshotFunction:
+		return "snapshot"
+	case strings.HasPrefix(field, "response.status."):
+		return strings.TrimPrefix(field, "response.")
+	case strings.HasPrefix(field, "headers."), strings.HasPrefix(field, "trailers."):
+		return field
+	case strings.HasPrefix(field, "conversation["):
+		entry, rest, _ := strings.Cut(field, "]")
+
+		return entry + "].expect" + rest
+	case strings.HasPrefix(field, "."):
+		return "response" + field
+	default:
+		return "response." + field
+	}
 }
 
 func (r *runner) prepareRequest(stepMD, serviceMD config.Metadata, request json.RawMessage) (map[string]string, json.RawMessage, error) {
-	err := r.variables.ReplaceMap(stepMD)
+	stepMD, err := r.variables.ReplaceMap(stepMD)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "metadata build error")
 	}
@@ -148,6 +434,36 @@ func (r *runner) prepareRequest(stepMD, serviceMD config.Metadata, request json.
 	return md, req, nil
 }
 
+type expectations struct {
+	status   *config.Status
+	response map[string]any
+	headers  map[string]any
+	trailers map[string]any
+	snapshot *snapshot
+}
+
+func (r *runner) prepareExpectations(step config.Step) (expectations, error) {
+	var err error
+	result := expectations{status: step.Status}
+
+	result.response, err = r.prepareResponse(step.Response)
+	if err != nil {
+		return result, err
+	}
+
+	result.headers, err = r.prepareResponse(step.Headers)
+	if err != nil {
+		return result, errors.Wrap(err, "headers")
+	}
+
+	result.trailers, err = r.prepareResponse(step.Trailers)
+	if err != nil {
+		return result, errors.Wrap(err, "trailers")
+	}
+
+	return result, nil
+}
+
 func (r *runner) prepareResponse(response json.RawMessage) (map[string]any, error) {
 	if len(response) == 0 {
 		return nil, nil
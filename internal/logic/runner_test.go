@@ -0,0 +1,640 @@
+package logic_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/logic"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/res-am/grpc-fts/internal/proto"
+	grpc_fts "github.com/res-am/grpc-fts/internal/proto/test_data"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoClient responds with the request message
+type echoClient struct{}
+
+func (c echoClient) Invoke(_ protoreflect.FullName, msg []byte, _ metadata.MD, _ proto.InvokeOptions) (*proto.GRPCResponse, error) {
+	res, err := c.BuildRequest((&grpc_fts.TestMessage{}).ProtoReflect().Descriptor(), msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.NewGRPCUnaryResponse(nil, res, metadata.Pairs("x-service", "echo"), metadata.Pairs("x-calls", "1", "x-calls", "2"), nil)
+}
+
+func (c echoClient) BuildRequest(desc protoreflect.MessageDescriptor, msg []byte) (*dynamicpb.Message, error) {
+	req := dynamicpb.NewMessage(desc)
+
+	return req, protojson.Unmarshal(msg, req)
+}
+
+func (c echoClient) Open(protoreflect.FullName, metadata.MD) (*proto.GRPCResponse, error) {
+	method := grpc_fts.File_test_test_proto.Services().ByName("TestService").Methods().ByName("BidiStreamMethod")
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &echoStream{ctx: ctx, messages: make(chan *dynamicpb.Message, 10)}
+
+	return proto.NewGRPCConversationResponse(stream, cancel, method, nil), nil
+}
+
+// echoStream is a bidirectional stream which responds with each sent message
+type echoStream struct {
+	grpc.ClientStream
+	ctx      context.Context
+	messages chan *dynamicpb.Message
+}
+
+func (s *echoStream) SendMsg(m any) error {
+	s.messages <- m.(*dynamicpb.Message)
+
+	return nil
+}
+
+func (s *echoStream) RecvMsg(m any) error {
+	select {
+	case message, ok := <-s.messages:
+		if !ok {
+			return io.EOF
+		}
+		b, err := protojson.Marshal(message)
+		if err != nil {
+			return err
+		}
+
+		return protojson.Unmarshal(b, m.(*dynamicpb.Message))
+	case <-s.ctx.Done():
+		return status.FromContextError(s.ctx.Err()).Err()
+	}
+}
+
+func (s *echoStream) CloseSend() error {
+	close(s.messages)
+
+	return nil
+}
+
+func (s *echoStream) Header() (metadata.MD, error) {
+	return metadata.Pairs("x-service", "echo"), nil
+}
+
+func (s *echoStream) Trailer() metadata.MD {
+	return nil
+}
+
+// streamClient responds with a server stream of messages of the request array
+type streamClient struct {
+	echoClient
+}
+
+func (c streamClient) Invoke(_ protoreflect.FullName, msg []byte, _ metadata.MD, _ proto.InvokeOptions) (*proto.GRPCResponse, error) {
+	var requests []json.RawMessage
+	if err := json.Unmarshal(msg, &requests); err != nil {
+		return nil, err
+	}
+
+	descriptor := (&grpc_fts.TestMessage{}).ProtoReflect().Descriptor()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := &echoStream{ctx: ctx, messages: make(chan *dynamicpb.Message, len(requests))}
+	for _, request := range requests {
+		message, err := c.BuildRequest(descriptor, request)
+		if err != nil {
+			cancel()
+
+			return nil, err
+		}
+		stream.messages <- message
+	}
+	close(stream.messages)
+
+	return proto.NewGRPCStreamResponse(stream, cancel, descriptor, nil)
+}
+
+// flakyClient responds with empty message until the given number of calls is made
+type flakyClient struct {
+	echoClient
+	failures int
+	calls    int
+}
+
+func (c *flakyClient) Invoke(
+	fullName protoreflect.FullName, msg []byte, md metadata.MD, options proto.InvokeOptions,
+) (*proto.GRPCResponse, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		msg = []byte("{}")
+	}
+
+	return c.echoClient.Invoke(fullName, msg, md, options)
+}
+
+// metadataClient responds with the value of x-role metadata
+type metadataClient struct {
+	echoClient
+}
+
+func (c metadataClient) Invoke(
+	fullName protoreflect.FullName, _ []byte, md metadata.MD, options proto.InvokeOptions,
+) (*proto.GRPCResponse, error) {
+	msg, err := json.Marshal(map[string]string{"data": strings.Join(md.Get("x-role"), ",")})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.echoClient.Invoke(fullName, msg, md, options)
+}
+
+type echoClientsManager struct {
+	client proto.Client
+}
+
+func (m echoClientsManager) GetClient(string) proto.Client {
+	if m.client != nil {
+		return m.client
+	}
+
+	return echoClient{}
+}
+
+type reportCollector struct {
+	report *models.Report
+}
+
+func (c *reportCollector) Report(report *models.Report) error {
+	c.report = report
+
+	return nil
+}
+
+func newRunContext(t *testing.T, args ...string) config.ContextWrapper {
+	flagSet := flag.NewFlagSet("", 0)
+	flagSet.String("configs", t.TempDir(), "")
+	flagSet.Bool("fail-fast", false, "")
+	flagSet.Int("parallel", 1, "")
+	flagSet.Var(cli.NewStringSlice(), "var", "")
+	flagSet.Bool("update-snapshots", false, "")
+	flagSet.String("target", "", "")
+	flagSet.Var(cli.NewStringSlice(), "ignore", "")
+	if err := flagSet.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	return config.NewContextWrapper(cli.NewContext(nil, flagSet, nil))
+}
+
+func echoStep(data string, expected string) config.Step {
+	request, _ := json.Marshal(map[string]string{"data": data})
+	response, _ := json.Marshal(map[string]string{"data": expected})
+
+	return config.Step{ServiceName: "test", Method: "UnaryMethod", Request: request, Response: response}
+}
+
+func runTestCases(t *testing.T, testCases config.TestCases, args ...string) (*models.Report, error) {
+	return runTestCasesWith(t, echoClientsManager{}, &config.Global{}, testCases, args...)
+}
+
+func runTestCasesWith(
+	t *testing.T, clients proto.ClientsManager, global *config.Global, testCases config.TestCases, args ...string,
+) (*models.Report, error) {
+	ctx := newRunContext(t, args...)
+	variables, err := logic.NewVariables(ctx)
+	assert.NoError(t, err)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	collector := &reportCollector{}
+	runner := logic.NewRunner(
+		ctx, testCases, clients, logrus.NewEntry(logger),
+		logic.NewResponseChecker(variables), variables, collector, global,
+	)
+
+	err = runner.RunTestCases()
+
+	return collector.report, err
+}
+
+func statuses(report *models.Report) map[string]models.TestCaseStatus {
+	result := make(map[string]models.TestCaseStatus, len(report.TestCases))
+	for _, testCase := range report.TestCases {
+		result[testCase.Name] = testCase.Status
+	}
+
+	return result
+}
+
+func TestRunner_RunTestCases(t *testing.T) {
+	testCases := config.TestCases{
+		{Name: "init", Steps: []config.Step{echoStep("ok", "ok")}},
+		{Name: "broken", Steps: []config.Step{echoStep("ok", "fail")}},
+		{Name: "dependent", DependsOn: []string{"broken"}, Steps: []config.Step{echoStep("ok", "ok")}},
+		{Name: "independent", DependsOn: []string{"init"}, Steps: []config.Step{echoStep("ok", "ok")}},
+	}
+
+	for _, args := range [][]string{nil, {"--parallel", "4"}} {
+		report, err := runTestCases(t, testCases, args...)
+
+		assert.ErrorAs(t, err, &models.UserErr{})
+		assert.Equal(t, map[string]models.TestCaseStatus{
+			"init":        models.StatusPassed,
+			"broken":      models.StatusFailed,
+			"dependent":   models.StatusSkipped,
+			"independent": models.StatusPassed,
+		}, statuses(report))
+	}
+}
+
+func TestRunner_RunTestCases_FailFast(t *testing.T) {
+	testCases := config.TestCases{
+		{Name: "broken", Steps: []config.Step{echoStep("ok", "fail")}},
+		{Name: "next", Steps: []config.Step{echoStep("ok", "ok")}},
+	}
+
+	report, err := runTestCases(t, testCases, "--fail-fast")
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, map[string]models.TestCaseStatus{
+		"broken": models.StatusFailed,
+		"next":   models.StatusSkipped,
+	}, statuses(report))
+}
+
+func TestRunner_RunTestCases_Retry(t *testing.T) {
+	step := echoStep("ok", "ok")
+	step.Retry = &config.Retry{Attempts: 5, Interval: config.Duration(time.Millisecond)}
+	testCases := config.TestCases{{Name: "eventual", Steps: []config.Step{step}}}
+
+	report, err := runTestCasesWith(t, echoClientsManager{client: &flakyClient{failures: 2}}, &config.Global{}, testCases)
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusPassed, report.TestCases[0].Status)
+	assert.Equal(t, 3, report.TestCases[0].Steps[0].Attempts)
+
+	step.Retry.Attempts = 2
+	report, err = runTestCasesWith(t, echoClientsManager{client: &flakyClient{failures: 2}}, &config.Global{}, testCases)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, models.StatusFailed, report.TestCases[0].Status)
+	assert.Equal(t, 2, report.TestCases[0].Steps[0].Attempts)
+}
+
+func TestRunner_RunTestCases_Metadata(t *testing.T) {
+	step := echoStep("ok", "ok")
+	step.Headers = json.RawMessage(`{"X-Service": "echo"}`)
+	step.Trailers = json.RawMessage(`{"x-calls": {"len": 2}}`)
+	report, err := runTestCases(t, config.TestCases{{Name: "metadata", Steps: []config.Step{step}}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusPassed, report.TestCases[0].Status)
+
+	step.Headers = json.RawMessage(`{"x-missing": "value", "x-service": {"not": "echo"}}`)
+	report, err = runTestCases(t, config.TestCases{{Name: "metadata", Steps: []config.Step{step}}})
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.ElementsMatch(t, []string{"headers.x-missing", "headers.x-service.not"}, failedFields(report))
+}
+
+func failedFields(report *models.Report) []string {
+	fields := make([]string, 0)
+	for _, testCase := range report.TestCases {
+		for _, step := range testCase.Steps {
+			for _, fail := range step.Fails {
+				fields = append(fields, fail.Field)
+			}
+		}
+	}
+
+	return fields
+}
+
+func TestRunner_RunTestCases_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	step := echoStep("first", "first")
+	step.Response = nil
+	step.Snapshot = &config.Snapshot{Enabled: true}
+	testCases := config.TestCases{{Name: "snapshot", Steps: []config.Step{step}}}
+
+	// missing snapshot fails the step, it's created only on update
+	report, err := runTestCases(t, testCases, "--configs", dir)
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, models.StatusErrored, report.TestCases[0].Status)
+	assert.Contains(t, report.TestCases[0].Message, "snapshot missing")
+	assert.NoFileExists(t, filepath.Join(dir, "test-cases", "__snapshots__", "snapshot.1.yaml"))
+
+	_, err = runTestCases(t, testCases, "--configs", dir, "--update-snapshots")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "test-cases", "__snapshots__", "snapshot.1.yaml"))
+
+	testCases[0].Steps[0].Request = json.RawMessage(`{"data": "second"}`)
+	report, err = runTestCases(t, testCases, "--configs", dir)
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, []models.ValidationFail{
+		models.Fail("data", "snapshot", `"first"`, `"second"`),
+	}, report.TestCases[0].Steps[0].Fails)
+
+	testCases[0].Steps[0].Snapshot.Redact = []string{"data"}
+	_, err = runTestCases(t, testCases, "--configs", dir, "--update-snapshots")
+	assert.NoError(t, err)
+
+	testCases[0].Steps[0].Request = json.RawMessage(`{"data": "third"}`)
+	_, err = runTestCases(t, testCases, "--configs", dir)
+	assert.NoError(t, err)
+}
+
+func TestRunner_RunTestCases_SnapshotSetup(t *testing.T) {
+	dir := t.TempDir()
+	step := echoStep("step", "step")
+	step.Response = nil
+	step.Snapshot = &config.Snapshot{Enabled: true}
+	setup := step
+	setup.Request = json.RawMessage(`{"data": "setup"}`)
+	testCases := config.TestCases{{Name: "snapshot", Setup: []config.Step{setup}, Steps: []config.Step{step}}}
+
+	_, err := runTestCases(t, testCases, "--configs", dir, "--update-snapshots")
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "test-cases", "__snapshots__", "snapshot.setup.1.yaml"))
+	assert.FileExists(t, filepath.Join(dir, "test-cases", "__snapshots__", "snapshot.1.yaml"))
+
+	// snapshot of the step is kept when setup steps change
+	testCases[0].Setup = append(testCases[0].Setup, echoStep("ok", "ok"))
+	_, err = runTestCases(t, testCases, "--configs", dir)
+	assert.NoError(t, err)
+}
+
+func TestRunner_RunTestCases_Teardown(t *testing.T) {
+	store := echoStep("created", "")
+	store.Response = json.RawMessage(`{"data": {"store": "id"}}`)
+	teardown := echoStep("$id", "created")
+	testCases := config.TestCases{{
+		Name:     "cleanup",
+		Setup:    []config.Step{store},
+		Steps:    []config.Step{echoStep("ok", "fail"), echoStep("ok", "ok")},
+		Teardown: []config.Step{echoStep("ok", "fail"), teardown},
+	}}
+
+	report, err := runTestCases(t, testCases)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	result := report.TestCases[0]
+	assert.Equal(t, models.StatusFailed, result.Status)
+	if assert.Len(t, result.Steps, 2) {
+		assert.Equal(t, "setup step 1", result.Steps[0].Name)
+		assert.Equal(t, "step 1", result.Steps[1].Name)
+	}
+	if assert.NotNil(t, result.Teardown) {
+		assert.Len(t, result.Teardown.Steps, 2)
+		assert.Equal(t, "test case cleanup, teardown step 1 failed", result.Teardown.Message)
+		assert.Empty(t, result.Teardown.Steps[1].Fails)
+	}
+}
+
+func TestRunner_RunTestCases_Global(t *testing.T) {
+	store := echoStep("token", "")
+	store.Response = json.RawMessage(`{"data": {"store": "token"}}`)
+	global := &config.Global{
+		Setup:    []config.Step{store},
+		Teardown: []config.Step{echoStep("$token", "token")},
+	}
+	testCases := config.TestCases{{Name: "authorized", Steps: []config.Step{echoStep("$token", "token")}}}
+
+	report, err := runTestCasesWith(t, echoClientsManager{}, global, testCases)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]models.TestCaseStatus{"authorized": models.StatusPassed}, statuses(report))
+	assert.False(t, report.Setup.Failed())
+	if assert.NotNil(t, report.Teardown) {
+		assert.Len(t, report.Teardown.Steps, 1)
+		assert.False(t, report.Teardown.Failed())
+	}
+
+	global.Setup = []config.Step{echoStep("ok", "fail")}
+	report, err = runTestCasesWith(t, echoClientsManager{}, global, testCases)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, map[string]models.TestCaseStatus{"authorized": models.StatusErrored}, statuses(report))
+	assert.Equal(t, "global setup step 1 failed", report.Setup.Message)
+	if assert.NotNil(t, report.Teardown) {
+		assert.Len(t, report.Teardown.Steps, 1)
+	}
+}
+
+func TestRunner_RunTestCases_Examples(t *testing.T) {
+	testCases := config.TestCases{
+		{Name: "role[admin]", Group: "role", Variables: map[string]any{"role": "admin"}, Steps: []config.Step{echoStep("$role", "admin")}},
+		{Name: "role[viewer]", Group: "role", Variables: map[string]any{"role": "viewer"}, Steps: []config.Step{echoStep("$role", "admin")}},
+	}
+
+	report, err := runTestCases(t, testCases)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, map[string]models.TestCaseStatus{
+		"role[admin]":  models.StatusPassed,
+		"role[viewer]": models.StatusFailed,
+	}, statuses(report))
+}
+
+const metadataExamplesTestCase = `
+name: role
+examples:
+  - name: admin
+    variables:
+      role: admin
+  - name: viewer
+    variables:
+      role: viewer
+steps:
+  - service: test
+    method: UnaryMethod
+    metadata:
+      x-role: ${role}
+    response:
+      data: ${role}
+`
+
+func TestRunner_RunTestCases_ExamplesMetadata(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "role.yaml"), []byte(metadataExamplesTestCase), 0o600))
+	services := config.Services{"test": config.Service{Service: "grpc_fts.TestService"}}
+
+	for _, args := range [][]string{nil, {"--parallel", "2"}} {
+		testCases, err := config.NewTestCases(newRunContext(t, "--configs", dir), logrus.NewEntry(logrus.New()), services)
+		assert.NoError(t, err)
+
+		report, err := runTestCasesWith(t, echoClientsManager{client: metadataClient{}}, &config.Global{}, testCases, args...)
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]models.TestCaseStatus{
+			"role[admin]":  models.StatusPassed,
+			"role[viewer]": models.StatusPassed,
+		}, statuses(report))
+	}
+}
+
+func TestRunner_RunTestCases_Outputs(t *testing.T) {
+	store := echoStep("e1", "e1")
+	store.Response = json.RawMessage(`{"data": {"store": "entity_id"}}`)
+	testCases := config.TestCases{
+		{Name: "init", Outputs: []string{"entity_id"}, Steps: []config.Step{store}},
+		{Name: "use", DependsOn: []string{"init"}, Steps: []config.Step{echoStep("${init.entity_id}", "e1")}},
+		{Name: "leak", DependsOn: []string{"init"}, Steps: []config.Step{echoStep("$entity_id", "e1")}},
+	}
+
+	report, err := runTestCases(t, testCases)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, map[string]models.TestCaseStatus{
+		"init": models.StatusPassed,
+		"use":  models.StatusPassed,
+		"leak": models.StatusErrored,
+	}, statuses(report))
+}
+
+func TestRunner_RunTestCases_Positions(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), os.ModePerm))
+	content := "steps:\n  - service: test\n    method: UnaryMethod\n    request: { data: a }\n    response:\n      data: b\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "echo.yaml"), []byte(content), 0o600))
+	services := config.Services{"test": config.Service{Service: "test.TestService"}}
+	testCases, err := config.NewTestCases(newRunContext(t, "--configs", dir), logrus.NewEntry(logrus.New()), services)
+	assert.NoError(t, err)
+
+	report, _ := runTestCases(t, testCases)
+
+	file := filepath.Join(dir, "test-cases", "echo.yaml")
+	if assert.Len(t, report.TestCases, 1) && assert.Len(t, report.TestCases[0].Steps, 1) {
+		step := report.TestCases[0].Steps[0]
+		assert.Equal(t, models.Position{File: file, Line: 2, Column: 5}, step.Position)
+		if assert.Len(t, step.Fails, 1) {
+			assert.Equal(t, models.Position{File: file, Line: 6, Column: 7}, step.Fails[0].Position)
+		}
+	}
+}
+
+func TestRunner_RunTestCases_Conversation(t *testing.T) {
+	conversation := func(entries string) config.Step {
+		step := config.Step{ServiceName: "test", Method: "BidiStreamMethod"}
+		if err := json.Unmarshal([]byte(entries), &step.Conversation); err != nil {
+			t.Fatal(err)
+		}
+
+		return step
+	}
+	testCases := config.TestCases{
+		{Name: "ping", Steps: []config.Step{conversation(`[
+			{"send": {"data": "ping"}},
+			{"expect": {"data": {"store": "reply"}}},
+			{"send": {"data": "${reply}-2"}},
+			{"expect": {"data": "ping-2"}},
+			{"half_close": true},
+			{"expect_close": true}
+		]`)}},
+		{Name: "silence", Steps: []config.Step{conversation(`[
+			{"expect": {"data": "ping"}, "timeout": "50ms"}
+		]`)}},
+		{Name: "unexpected", Steps: []config.Step{conversation(`[
+			{"send": {"data": "ping"}},
+			{"expect_close": true}
+		]`)}},
+	}
+
+	report, err := runTestCases(t, testCases)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, map[string]models.TestCaseStatus{
+		"ping":       models.StatusPassed,
+		"silence":    models.StatusFailed,
+		"unexpected": models.StatusFailed,
+	}, statuses(report))
+	assert.ElementsMatch(t, []string{"conversation[0]", "conversation[1]"}, failedFields(report))
+}
+
+func TestRunner_RunTestCases_ConversationRetry(t *testing.T) {
+	step := config.Step{ServiceName: "test", Method: "BidiStreamMethod"}
+	step.Retry = &config.Retry{Attempts: 2, Interval: config.Duration(time.Millisecond)}
+	step.Conversation = []config.ConversationEntry{
+		{Send: json.RawMessage(`{"data": "ping"}`)},
+		{Expect: json.RawMessage(`{"data": {"store": "reply"}}`)},
+		{Send: json.RawMessage(`{"data": "ping"}`)},
+		{Expect: json.RawMessage(`{"data": "pong"}`)},
+	}
+	testCases := config.TestCases{{
+		Name:     "retried",
+		Steps:    []config.Step{step},
+		Teardown: []config.Step{echoStep("$reply", "ping")},
+	}}
+
+	report, err := runTestCases(t, testCases)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	result := report.TestCases[0]
+	assert.Equal(t, models.StatusFailed, result.Status)
+	assert.Equal(t, 2, result.Steps[0].Attempts)
+	if assert.NotNil(t, result.Teardown) {
+		assert.Contains(t, result.Teardown.Message, logic.ErrVariableNotFound.Error())
+	}
+}
+
+func TestRunner_RunTestCases_Stream(t *testing.T) {
+	streamStep := func(messages, expectations string) []config.Step {
+		return []config.Step{{
+			ServiceName: "test", Method: "ServerStreamMethod",
+			Request: json.RawMessage(messages), Response: json.RawMessage(expectations),
+		}}
+	}
+	testCases := config.TestCases{
+		{Name: "ordered", Steps: streamStep(
+			`[{"data": "a"}, {"data": "b"}]`,
+			`{"stream": [{"data": "a"}, {"data": "b"}]}`,
+		)},
+		{Name: "extra", Steps: streamStep(
+			`[{"data": "a"}, {"data": "b"}, {"data": "c"}]`,
+			`{"stream": [{"data": "a"}, {"data": "b"}]}`,
+		)},
+		{Name: "mismatch", Steps: streamStep(
+			`[{"data": "a"}, {"data": "x"}]`,
+			`{"stream": [{"data": "a"}, {"data": "b"}]}`,
+		)},
+		{Name: "unordered", Steps: streamStep(
+			`[{"data": "b"}, {"data": "a"}, {"data": "c"}]`,
+			`{
+				"stream": [{"data": "a"}, {"data": "b"}], "unordered": true, "count": {"gte": 3},
+				"any_message": {"data": "c"}, "all_messages": {"data": {"one_of": ["a", "b", "c"]}}, "last": {"data": "c"}
+			}`,
+		)},
+		{Name: "stop", Steps: streamStep(
+			`[{"data": "a"}, {"data": "b"}, {"data": "c"}]`,
+			`{"stream": [{"data": "a"}], "stop_after": 1}`,
+		)},
+		{Name: "counted", Steps: append(
+			streamStep(`[{"data": "a"}, {"data": "b"}]`, `{"unordered": true, "count": {"store": "count"}}`),
+			streamStep(`[{"data": "count ${count}"}]`, `{"stream": [{"data": "count 2"}]}`)...,
+		)},
+	}
+
+	report, err := runTestCasesWith(t, echoClientsManager{client: streamClient{}}, &config.Global{}, testCases)
+
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.Equal(t, map[string]models.TestCaseStatus{
+		"ordered":   models.StatusPassed,
+		"extra":     models.StatusFailed,
+		"mismatch":  models.StatusFailed,
+		"unordered": models.StatusPassed,
+		"stop":      models.StatusPassed,
+		"counted":   models.StatusPassed,
+	}, statuses(report))
+	assert.ElementsMatch(t, []string{"stream[2]", "stream[1].data"}, failedFields(report))
+}
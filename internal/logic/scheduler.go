@@ -0,0 +1,148 @@
+package logic
+
+import (
+	"bytes"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/sirupsen/logrus"
+)
+
+// schedule keeps the state of test cases execution along the dependency graph.
+// Test case starts only when all of its dependencies have passed, dependents of failed test cases are skipped.
+type schedule struct {
+	queue    config.TestCases
+	passed   map[string]struct{}
+	failed   failedDependencies
+	running  int
+	stopped  bool
+	outcomes chan testCaseOutcome
+}
+
+type testCaseOutcome struct {
+	result models.TestCaseResult
+	err    error
+	output *bytes.Buffer
+}
+
+func (r *runner) runTestCases(report *models.Report) {
+	s := &schedule{
+		queue:    append(config.TestCases{}, r.testCases...),
+		passed:   make(map[string]struct{}, len(r.testCases)),
+		failed:   make(failedDependencies),
+		outcomes: make(chan testCaseOutcome),
+	}
+
+	for {
+		if !s.stopped {
+			r.startReady(s, report)
+		}
+		if s.running == 0 {
+			break
+		}
+
+		outcome := <-s.outcomes
+		s.running--
+		r.finished(s, report, outcome)
+	}
+
+	reason := "dependencies were not run"
+	if s.stopped {
+		reason = "run was stopped by fail fast mode"
+	}
+	r.skipRemaining(report, s.queue, reason)
+}
+
+// startReady starts test cases which dependencies have passed, while there are free slots.
+// Test cases with failed dependencies are skipped right away.
+func (r *runner) startReady(s *schedule, report *models.Report) {
+	waiting := s.queue[:0]
+	for _, testCase := range s.queue {
+		if failed, dependency := s.failed.HasDependencyFailed(testCase.DependsOn); failed {
+			r.logger.Infof("test case %s skipped due to failed dependency %s", testCase.Name, dependency)
+			s.failed.Add(testCase.Name)
+			report.Add(models.TestCaseResult{
+				Name:    testCase.Name,
+				Status:  models.StatusSkipped,
+				Message: "failed dependency " + dependency,
+			})
+
+			continue
+		}
+
+		if s.running >= r.parallel || !s.dependenciesPassed(testCase.DependsOn) {
+			waiting = append(waiting, testCase)
+
+			continue
+		}
+
+		s.running++
+		go func(testCase config.TestCase) {
+			logger, output := r.testCaseLogger()
+			result, err := r.runTestCase(testCase, logger)
+			s.outcomes <- testCaseOutcome{result: result, err: err, output: output}
+		}(testCase)
+	}
+
+	s.queue = waiting
+}
+
+func (r *runner) finished(s *schedule, report *models.Report, outcome testCaseOutcome) {
+	if outcome.output != nil {
+		_, _ = r.logger.Logger.Out.Write(outcome.output.Bytes())
+	}
+
+	name := outcome.result.Name
+	report.Add(outcome.result)
+	switch outcome.result.Status {
+	case models.StatusPassed:
+		r.logger.Infof("test case %s was finished successfully", name)
+		s.passed[name] = struct{}{}
+
+		return
+	case models.StatusErrored:
+		r.logger.WithError(outcome.err).Errorf("test case %s was finished with error", name)
+	case models.StatusFailed, models.StatusSkipped:
+	}
+
+	s.failed.Add(name)
+	if r.failFast {
+		s.stopped = true
+	}
+}
+
+// testCaseLogger returns logger for a single test case. In parallel mode the output is buffered
+// and written at once when the test case is finished to keep it readable.
+func (r *runner) testCaseLogger() (*logrus.Entry, *bytes.Buffer) {
+	if r.parallel <= 1 {
+		return r.logger, nil
+	}
+
+	output := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.SetOutput(output)
+	logger.SetFormatter(r.logger.Logger.Formatter)
+	logger.SetLevel(r.logger.Logger.GetLevel())
+
+	return logrus.NewEntry(logger).WithFields(r.logger.Data), output
+}
+
+func (r *runner) skipRemaining(report *models.Report, testCases config.TestCases, reason string) {
+	for _, testCase := range testCases {
+		r.logger.Infof("test case %s skipped: %s", testCase.Name, reason)
+		report.Add(models.TestCaseResult{
+			Name:    testCase.Name,
+			Status:  models.StatusSkipped,
+			Message: reason,
+		})
+	}
+}
+
+func (s *schedule) dependenciesPassed(dependsOn []string) bool {
+	for _, dependency := range dependsOn {
+		if _, ok := s.passed[dependency]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,231 @@
+package logic
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	snapshotsDir       = "__snapshots__"
+	snapshotFunction   = "snapshot"
+	redactedValue      = "<redacted>"
+	absentSnapshotItem = "<absent>"
+)
+
+// snapshot compares the full response with the golden file
+type snapshot struct {
+	path   string
+	ignore map[string]struct{}
+	redact map[string]struct{}
+	// update makes snapshot write the actual response instead of comparing it
+	update bool
+}
+
+func newSnapshot(dir, name string, cfg *config.Snapshot, update bool) *snapshot {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+
+	result := &snapshot{
+		path:   filepath.Join(dir, name+".yaml"),
+		ignore: make(map[string]struct{}, len(cfg.Ignore)),
+		redact: make(map[string]struct{}, len(cfg.Redact)),
+		update: update,
+	}
+	for _, path := range cfg.Ignore {
+		result.ignore[path] = struct{}{}
+	}
+	for _, path := range cfg.Redact {
+		result.redact[path] = struct{}{}
+	}
+
+	return result
+}
+
+// check returns a fail for each difference between the snapshot and the response. Snapshots are written
+// only on update, so a missing one doesn't silently accept any response.
+func (s *snapshot) check(response map[string]any) ([]models.ValidationFail, error) {
+	actual := s.normalize("", response)
+	if s.update {
+		return nil, s.write(actual)
+	}
+
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Errorf("snapshot missing: %s, run with --update-snapshots to create it", s.path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading snapshot %s", s.path)
+	}
+
+	var expected any
+	if err := yaml.Unmarshal(content, &expected); err != nil {
+		return nil, models.NewErr(fmt.Sprintf("error parsing snapshot %s: %s", s.path, err.Error()))
+	}
+
+	fails := make([]models.ValidationFail, 0)
+	diff("", expected, actual, &fails)
+	if len(fails) > 0 {
+		return fails, ErrValidationFailed
+	}
+
+	return nil, nil
+}
+
+func (s *snapshot) write(actual any) error {
+	content, err := yaml.Marshal(actual)
+	if err != nil {
+		return errors.Wrap(err, "error marshalling snapshot")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return errors.Wrap(err, "error creating snapshots directory")
+	}
+
+	if err := os.WriteFile(s.path, content, 0o600); err != nil {
+		return errors.Wrapf(err, "error writing snapshot %s", s.path)
+	}
+
+	return nil
+}
+
+// normalize returns a copy of the value without ignored fields and with redacted ones,
+// paths don't contain indexes of arrays, so they're applied to each element
+func (s *snapshot) normalize(path string, value any) any {
+	switch t := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(t))
+		for key, item := range t {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+
+			if _, ok := s.ignore[fieldPath]; ok {
+				continue
+			}
+			if _, ok := s.redact[fieldPath]; ok {
+				result[key] = redactedValue
+
+				continue
+			}
+
+			result[key] = s.normalize(fieldPath, item)
+		}
+
+		return result
+	case []any:
+		result := make([]any, 0, len(t))
+		for _, item := range t {
+			result = append(result, s.normalize(path, item))
+		}
+
+		return result
+	default:
+		return value
+	}
+}
+
+// diff collects differences between expected and actual values as fails with snapshot function,
+// missing values are marked as absent
+func diff(path string, expected, actual any, fails *[]models.ValidationFail) {
+	expectedObject, isExpectedObject := expected.(map[string]any)
+	actualObject, isActualObject := actual.(map[string]any)
+	if isExpectedObject && isActualObject {
+		keys := make(map[string]struct{}, len(expectedObject)+len(actualObject))
+		for key := range expectedObject {
+			keys[key] = struct{}{}
+		}
+		for key := range actualObject {
+			keys[key] = struct{}{}
+		}
+
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+
+			expectedValue, ok := expectedObject[key]
+			if !ok {
+				expectedValue = absentSnapshotItem
+			}
+			actualValue, ok := actualObject[key]
+			if !ok {
+				actualValue = absentSnapshotItem
+			}
+
+			diff(fieldPath, expectedValue, actualValue, fails)
+		}
+
+		return
+	}
+
+	expectedItems, isExpectedArray := expected.([]any)
+	actualItems, isActualArray := actual.([]any)
+	if isExpectedArray && isActualArray {
+		for i := 0; i < max(len(expectedItems), len(actualItems)); i++ {
+			var expectedItem, actualItem any = absentSnapshotItem, absentSnapshotItem
+			if i < len(expectedItems) {
+				expectedItem = expectedItems[i]
+			}
+			if i < len(actualItems) {
+				actualItem = actualItems[i]
+			}
+
+			diff(fmt.Sprintf("%s[%d]", path, i), expectedItem, actualItem, fails)
+		}
+
+		return
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		*fails = append(*fails, models.Fail(path, snapshotFunction, snapshotValue(expected), snapshotValue(actual)))
+	}
+}
+
+func snapshotValue(value any) string {
+	if value == absentSnapshotItem {
+		return absentSnapshotItem
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(b)
+}
+
+// snapshotDiff formats snapshot fails as a diff, lines are prefixed with - for removed values,
+// + for added values and ~ for changed ones
+func snapshotDiff(fails []models.ValidationFail) string {
+	lines := make([]string, 0, len(fails))
+	for _, fail := range fails {
+		switch {
+		case fail.Expectation == absentSnapshotItem:
+			lines = append(lines, fmt.Sprintf("  + %s: %s", fail.Field, fail.ActualValue))
+		case fail.ActualValue == absentSnapshotItem:
+			lines = append(lines, fmt.Sprintf("  - %s: %v", fail.Field, fail.Expectation))
+		default:
+			lines = append(lines, fmt.Sprintf("  ~ %s: %v => %s", fail.Field, fail.Expectation, fail.ActualValue))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,311 @@
+package logic
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/res-am/grpc-fts/internal/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"strings"
+)
+
+// streamKeys are keys of server stream expectations, they're written in place of response fields
+var streamKeys = map[string]struct{}{
+	"stream": {}, "unordered": {}, "count": {}, "any_message": {}, "all_messages": {}, "last": {}, "stop_after": {},
+}
+
+// streamExpectations are expectations of server stream messages. Messages of stream are matched in order,
+// or each to a distinct message if unordered is set. Without count, extra and missing messages fail.
+type streamExpectations struct {
+	messages    []map[string]any
+	unordered   bool
+	count       any
+	anyMessage  map[string]any
+	allMessages map[string]any
+	last        map[string]any
+	// stopAfter is a number of messages after which the stream is cancelled, 0 means the whole stream is received
+	stopAfter int
+}
+
+func newStreamExpectations(response map[string]any) (streamExpectations, error) {
+	var result streamExpectations
+	for key := range response {
+		if _, ok := streamKeys[key]; !ok {
+			return result, errors.Errorf("unexpected key %s of stream response", key)
+		}
+	}
+
+	if stream, ok := response["stream"]; ok {
+		items, ok := stream.([]any)
+		if !ok {
+			return result, errors.New("stream should be an array of messages")
+		}
+		for i, item := range items {
+			message, ok := item.(map[string]any)
+			if !ok {
+				return result, errors.Errorf("stream[%d] should be a message", i)
+			}
+			result.messages = append(result.messages, message)
+		}
+	}
+
+	var ok bool
+	if value, exists := response["unordered"]; exists {
+		if result.unordered, ok = value.(bool); !ok {
+			return result, errors.New("unordered should be a boolean")
+		}
+	}
+	if value, exists := response["stop_after"]; exists {
+		number, ok := value.(float64)
+		if !ok || number < 1 || number != float64(int(number)) {
+			return result, errors.New("stop_after should be a positive integer")
+		}
+		result.stopAfter = int(number)
+	}
+	for key, target := range map[string]*map[string]any{
+		"any_message": &result.anyMessage, "all_messages": &result.allMessages, "last": &result.last,
+	} {
+		if value, exists := response[key]; exists {
+			if *target, ok = value.(map[string]any); !ok {
+				return result, errors.Errorf("%s should be a message", key)
+			}
+		}
+	}
+	result.count = response["count"]
+
+	return result, nil
+}
+
+// checkStream receives messages of the server stream and checks them, status of the stream is checked
+// only if it's finished
+func (r *runner) checkStream(expected expectations, response *proto.GRPCResponse, stored map[string]any) ([]models.ValidationFail, error) {
+	stream, err := newStreamExpectations(expected.response)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, finished, err := receiveStream(response, stream.stopAfter)
+	if err != nil {
+		return nil, err
+	}
+
+	fails := make([]models.ValidationFail, 0)
+	if finished {
+		statusFails, err := r.checker.CheckStatus(response.Status, response.StatusDetails, expected.status, stored)
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return nil, err
+		}
+		fails = append(fails, statusFails...)
+	}
+
+	messageFails, err := r.checkMessages(stream, messages, response.Descriptor(), stored)
+	if err != nil {
+		return nil, err
+	}
+	fails = append(fails, messageFails...)
+
+	return r.checkMetadata(fails, expected, response, stored)
+}
+
+// receiveStream receives messages until the stream is finished or stopAfter messages are received,
+// in the latter case the stream is cancelled. Stream finished without error gets OK status.
+func receiveStream(response *proto.GRPCResponse, stopAfter int) (messages []map[string]any, finished bool, err error) {
+	messages = make([]map[string]any, 0)
+	for stopAfter == 0 || len(messages) < stopAfter {
+		err := response.StreamReceive()
+		if errors.Is(err, io.EOF) {
+			response.Status = status.New(codes.OK, "")
+			response.StatusDetails = nil
+
+			return messages, true, nil
+		}
+		if err != nil {
+			return nil, false, errors.Wrap(err, "error on stream receiving")
+		}
+		if response.Status.Code() != codes.OK {
+			return messages, true, nil
+		}
+
+		messages = append(messages, response.Response)
+	}
+	response.Close()
+
+	return messages, false, nil
+}
+
+func (r *runner) checkMessages(
+	stream streamExpectations, messages []map[string]any, descriptor protoreflect.MessageDescriptor, stored map[string]any,
+) ([]models.ValidationFail, error) {
+	check := func(i int, expectations map[string]any, stored map[string]any) ([]models.ValidationFail, error) {
+		field := fmt.Sprintf("stream[%d]", i)
+		fails, err := r.checker.CheckResponse(messages[i], descriptor, expectations, stored)
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return nil, errors.Wrapf(err, "error checking %s", field)
+		}
+
+		return prefixFails(field, fails), nil
+	}
+
+	var fails []models.ValidationFail
+	var err error
+	if stream.unordered {
+		fails, err = r.checkUnordered(stream, messages, check, stored)
+	} else {
+		fails, err = r.checkOrdered(stream, messages, check, stored)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if stream.count != nil {
+		countFails, err := r.checker.CheckResponse(
+			map[string]any{"count": float64(len(messages))}, nil, map[string]any{"count": stream.count}, stored,
+		)
+		if err != nil && !errors.Is(err, ErrValidationFailed) {
+			return nil, errors.Wrap(err, "error checking count of messages")
+		}
+		fails = append(fails, countFails...)
+	}
+
+	if stream.anyMessage != nil {
+		matched := false
+		for i := range messages {
+			messageStored := make(map[string]any)
+			messageFails, err := check(i, stream.anyMessage, messageStored)
+			if err != nil {
+				return nil, err
+			}
+			if len(messageFails) == 0 {
+				mergeStored(stored, messageStored)
+				matched = true
+
+				break
+			}
+		}
+		if !matched {
+			actual := fmt.Sprintf("none of %d messages", len(messages))
+			fails = append(fails, models.Fail("any_message", "any_message", stream.anyMessage, actual))
+		}
+	}
+
+	if stream.allMessages != nil {
+		for i := range messages {
+			messageFails, err := check(i, stream.allMessages, stored)
+			if err != nil {
+				return nil, err
+			}
+			fails = append(fails, messageFails...)
+		}
+	}
+
+	if stream.last != nil {
+		if len(messages) == 0 {
+			fails = append(fails, models.Fail("last", "last", stream.last, "no messages"))
+		} else {
+			lastFails, err := check(len(messages)-1, stream.last, stored)
+			if err != nil {
+				return nil, err
+			}
+			fails = append(fails, lastFails...)
+		}
+	}
+
+	return fails, nil
+}
+
+type messageCheck func(i int, expectations map[string]any, stored map[string]any) ([]models.ValidationFail, error)
+
+// checkOrdered checks each expected message against the message of the same index. Without count,
+// missing and extra messages fail.
+func (r *runner) checkOrdered(
+	stream streamExpectations, messages []map[string]any, check messageCheck, stored map[string]any,
+) ([]models.ValidationFail, error) {
+	fails := make([]models.ValidationFail, 0)
+	for i, expectations := range stream.messages {
+		if i >= len(messages) {
+			fails = append(fails, models.Fail(fmt.Sprintf("stream[%d]", i), "stream", expectations, "no message"))
+
+			continue
+		}
+
+		messageFails, err := check(i, expectations, stored)
+		if err != nil {
+			return nil, err
+		}
+		fails = append(fails, messageFails...)
+	}
+
+	if stream.count == nil && stream.messages != nil {
+		for i := len(stream.messages); i < len(messages); i++ {
+			actual := formatVariable(messages[i])
+			fails = append(fails, models.Fail(fmt.Sprintf("stream[%d]", i), "stream", "end of stream", actual))
+		}
+	}
+
+	return fails, nil
+}
+
+// checkUnordered matches each expected message to a distinct message of the stream. Without count,
+// messages which are not matched fail.
+func (r *runner) checkUnordered(
+	stream streamExpectations, messages []map[string]any, check messageCheck, stored map[string]any,
+) ([]models.ValidationFail, error) {
+	fails := make([]models.ValidationFail, 0)
+	matched := make([]bool, len(messages))
+	for i, expectations := range stream.messages {
+		found := false
+		for j := range messages {
+			if matched[j] {
+				continue
+			}
+
+			messageStored := make(map[string]any)
+			messageFails, err := check(j, expectations, messageStored)
+			if err != nil {
+				return nil, err
+			}
+			if len(messageFails) == 0 {
+				mergeStored(stored, messageStored)
+				matched[j] = true
+				found = true
+
+				break
+			}
+		}
+		if !found {
+			fails = append(fails, models.Fail(fmt.Sprintf("stream[%d]", i), "unordered", expectations, "no matching message"))
+		}
+	}
+
+	if stream.count == nil && stream.messages != nil {
+		for j, ok := range matched {
+			if !ok {
+				fails = append(fails, models.Fail(fmt.Sprintf("stream[%d]", j), "unordered", "no message", formatVariable(messages[j])))
+			}
+		}
+	}
+
+	return fails, nil
+}
+
+// prefixFails prepends the field of the message to fields of its fails, like stream[1].id
+func prefixFails(prefix string, fails []models.ValidationFail) []models.ValidationFail {
+	for i := range fails {
+		field := fails[i].Field
+		if field != "" && !strings.HasPrefix(field, ".") && !strings.HasPrefix(field, "[") {
+			field = "." + field
+		}
+		fails[i].Field = prefix + field
+	}
+
+	return fails
+}
+
+func mergeStored(stored, values map[string]any) {
+	for key, value := range values {
+		stored[key] = value
+	}
+}
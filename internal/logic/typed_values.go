@@ -0,0 +1,349 @@
+package logic
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const wellKnownPackage = "google.protobuf"
+
+// typedValue is a response value with a special json mapping, it's compared with expectations
+// by its meaning instead of json representation
+type typedValue interface {
+	equal(expectation any) (bool, error)
+	// compare returns -1, 0 or +1 if the value is less, equal or greater than the expectation
+	compare(expectation any) (int, error)
+	String() string
+}
+
+// temporalValue is a typed value which supports `within` function
+type temporalValue interface {
+	typedValue
+	// offset returns difference between the value and the reference
+	offset(reference string) (time.Duration, error)
+}
+
+// enumValue can be matched both by name and by number, ordering functions compare numbers
+type enumValue struct {
+	name   string
+	number protoreflect.EnumNumber
+	enum   protoreflect.EnumDescriptor
+}
+
+func (v enumValue) equal(expectation any) (bool, error) {
+	number, err := v.expectedNumber(expectation)
+	if err != nil {
+		return false, err
+	}
+
+	return number == v.number, nil
+}
+
+func (v enumValue) compare(expectation any) (int, error) {
+	number, err := v.expectedNumber(expectation)
+	if err != nil {
+		return 0, err
+	}
+
+	return cmp.Compare(v.number, number), nil
+}
+
+func (v enumValue) expectedNumber(expectation any) (protoreflect.EnumNumber, error) {
+	switch t := expectation.(type) {
+	case float64:
+		return protoreflect.EnumNumber(t), nil
+	case string:
+		value := v.enum.Values().ByName(protoreflect.Name(t))
+		if value == nil {
+			return 0, fmt.Errorf("enum %s has no value %s", v.enum.FullName(), t)
+		}
+
+		return value.Number(), nil
+	default:
+		return 0, fmt.Errorf("enum name or number was expected, got %v", expectation)
+	}
+}
+
+func (v enumValue) String() string {
+	if v.name == "" {
+		return strconv.Itoa(int(v.number))
+	}
+
+	return v.name
+}
+
+// timestampValue is google.protobuf.Timestamp, expectations are RFC 3339 strings or `now`
+type timestampValue struct {
+	time time.Time
+	raw  string
+}
+
+func (v timestampValue) equal(expectation any) (bool, error) {
+	result, err := v.compare(expectation)
+
+	return result == 0, err
+}
+
+func (v timestampValue) compare(expectation any) (int, error) {
+	expected, ok := expectation.(string)
+	if !ok {
+		return 0, fmt.Errorf("timestamp string was expected, got %v", expectation)
+	}
+
+	reference, err := parseTime(expected)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.time.Compare(reference), nil
+}
+
+func (v timestampValue) offset(reference string) (time.Duration, error) {
+	parsed, err := parseTime(reference)
+	if err != nil {
+		return 0, err
+	}
+
+	return v.time.Sub(parsed), nil
+}
+
+func (v timestampValue) String() string {
+	return v.raw
+}
+
+// durationValue is google.protobuf.Duration, expectations are duration strings like 1.5s or 2m
+type durationValue struct {
+	duration time.Duration
+	raw      string
+}
+
+func (v durationValue) equal(expectation any) (bool, error) {
+	result, err := v.compare(expectation)
+
+	return result == 0, err
+}
+
+func (v durationValue) compare(expectation any) (int, error) {
+	expected, ok := expectation.(string)
+	if !ok {
+		return 0, fmt.Errorf("duration string was expected, got %v", expectation)
+	}
+
+	reference, err := time.ParseDuration(expected)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid duration %s", expected)
+	}
+
+	return cmp.Compare(v.duration, reference), nil
+}
+
+func (v durationValue) offset(reference string) (time.Duration, error) {
+	parsed, err := time.ParseDuration(reference)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid duration %s", reference)
+	}
+
+	return v.duration - parsed, nil
+}
+
+func (v durationValue) String() string {
+	return v.raw
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "now" {
+		return time.Now(), nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid timestamp %s", value)
+	}
+
+	return parsed, nil
+}
+
+// typedMessage converts json values of the message to typed values by its descriptor: 64-bit integers
+// (encoded as strings in json) to numbers, enums, Timestamps and Durations to typedValue.
+// Fields which are not found in the descriptor and values which can't be converted are kept as is.
+func typedMessage(message map[string]any, desc protoreflect.MessageDescriptor) map[string]any {
+	result := make(map[string]any, len(message))
+	for key, value := range message {
+		field := desc.Fields().ByJSONName(key)
+		if field == nil {
+			field = desc.Fields().ByName(protoreflect.Name(key))
+		}
+		if field == nil {
+			result[key] = value
+
+			continue
+		}
+
+		result[key] = typedField(value, field)
+	}
+
+	return result
+}
+
+// plainValue converts typed values back to their json representation, so they can be stored and substituted
+func plainValue(value any) any {
+	switch t := value.(type) {
+	case typedValue:
+		return t.String()
+	case map[string]any:
+		result := make(map[string]any, len(t))
+		for key, item := range t {
+			result[key] = plainValue(item)
+		}
+
+		return result
+	case []any:
+		result := make([]any, 0, len(t))
+		for _, item := range t {
+			result = append(result, plainValue(item))
+		}
+
+		return result
+	default:
+		return value
+	}
+}
+
+func typedField(value any, field protoreflect.FieldDescriptor) any {
+	switch {
+	case field.IsMap():
+		entries, ok := value.(map[string]any)
+		if !ok {
+			return value
+		}
+
+		result := make(map[string]any, len(entries))
+		for key, entry := range entries {
+			result[key] = typedSingular(entry, field.MapValue())
+		}
+
+		return result
+	case field.IsList():
+		items, ok := value.([]any)
+		if !ok {
+			return value
+		}
+
+		result := make([]any, 0, len(items))
+		for _, item := range items {
+			result = append(result, typedSingular(item, field))
+		}
+
+		return result
+	default:
+		return typedSingular(value, field)
+	}
+}
+
+func typedSingular(value any, field protoreflect.FieldDescriptor) any {
+	switch field.Kind() { //nolint:exhaustive
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return typedInt(value)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return typedUint(value)
+	case protoreflect.EnumKind:
+		return typedEnum(value, field.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return typedMessageValue(value, field.Message())
+	default:
+		return value
+	}
+}
+
+func typedMessageValue(value any, desc protoreflect.MessageDescriptor) any {
+	raw, isString := value.(string)
+	switch desc.FullName() {
+	case wellKnownPackage + ".Timestamp":
+		if parsed, err := time.Parse(time.RFC3339Nano, raw); isString && err == nil {
+			return timestampValue{time: parsed, raw: raw}
+		}
+	case wellKnownPackage + ".Duration":
+		if parsed, err := time.ParseDuration(raw); isString && err == nil {
+			return durationValue{duration: parsed, raw: raw}
+		}
+	case wellKnownPackage + ".Int64Value":
+		return typedInt(value)
+	case wellKnownPackage + ".UInt64Value":
+		return typedUint(value)
+	}
+
+	// other well-known types like Struct and Any have their own json mapping
+	message, ok := value.(map[string]any)
+	if !ok || desc.ParentFile().Package() == wellKnownPackage {
+		return value
+	}
+
+	return typedMessage(message, desc)
+}
+
+func typedInt(value any) any {
+	raw, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	parsed, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return value
+	}
+
+	return parsed
+}
+
+func typedUint(value any) any {
+	raw, ok := value.(string)
+	if !ok {
+		return value
+	}
+
+	parsed, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return value
+	}
+
+	return parsed
+}
+
+func typedEnum(value any, enum protoreflect.EnumDescriptor) any {
+	switch t := value.(type) {
+	case string:
+		if enumValueDesc := enum.Values().ByName(protoreflect.Name(t)); enumValueDesc != nil {
+			return enumValue{name: t, number: enumValueDesc.Number(), enum: enum}
+		}
+	case float64:
+		// unknown values are encoded as numbers
+		return enumValue{number: protoreflect.EnumNumber(t), enum: enum}
+	}
+
+	return value
+}
+
+// parseWithin parses expectation of `within` function, like `5m of now`
+func parseWithin(expectation any) (time.Duration, string, error) {
+	raw, ok := expectation.(string)
+	if !ok {
+		return 0, "", fmt.Errorf("string like `5m of now` was expected, got %v", expectation)
+	}
+
+	tolerance, reference, found := strings.Cut(raw, " of ")
+	if !found {
+		return 0, "", fmt.Errorf("invalid expectation %s, `<duration> of <reference>` was expected", raw)
+	}
+
+	parsed, err := time.ParseDuration(strings.TrimSpace(tolerance))
+	if err != nil {
+		return 0, "", errors.Wrapf(err, "invalid tolerance %s", tolerance)
+	}
+
+	return parsed, strings.TrimSpace(reference), nil
+}
@@ -5,59 +5,590 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
 	"github.com/res-am/grpc-fts/internal/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
 )
 
+// ValidationError is a problem of the configuration at the position of its source
+type ValidationError struct {
+	// Position is unknown only for configs which are not read from files
+	Position models.Position
+	Err      error
+}
+
+func (e ValidationError) Error() string {
+	if !e.Position.IsKnown() {
+		return e.Err.Error()
+	}
+
+	return e.Position.String() + ": " + e.Err.Error()
+}
+
+func (e ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors are all problems found by validation, they're reported at once
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("%d problems found:\n%s", len(e), strings.Join(messages, "\n"))
+}
+
 type validator struct {
 	clientsManager proto.ClientsManager
 	manager        proto.DescriptorsManager
 	checker        ResponseChecker
+	global         *config.Global
+	variables      *Variables
 }
 
-func NewValidator(clientsManager proto.ClientsManager, manager proto.DescriptorsManager, checker ResponseChecker) Validator {
+func NewValidator(
+	clientsManager proto.ClientsManager, manager proto.DescriptorsManager, checker ResponseChecker, global *config.Global,
+	variables *Variables,
+) Validator {
 	return &validator{
 		clientsManager: clientsManager,
 		manager:        manager,
 		checker:        checker,
+		global:         global,
+		variables:      variables,
 	}
 }
 
+// Validate checks all test cases and global steps, problems of all of them are returned as ValidationErrors
 func (v validator) Validate(testCases config.TestCases) error {
+	var problems ValidationErrors
+
+	// values stored by global setup are available to all test cases and global teardown
+	global := make(map[string]struct{})
+	problems = append(problems, v.validateSteps("global setup step", v.global.Setup, definedNames{local: global})...)
+	teardown := definedNames{local: maps.Clone(global)}
+	problems = append(problems, v.validateSteps("global teardown step", v.global.Teardown, teardown)...)
+	problems = append(problems, v.validateServices(testCases)...)
+	for _, problem := range testCases.UnknownDependencies() {
+		problems = append(problems, ValidationError{Position: problem.Position, Err: problem})
+	}
+
+	byName := make(map[string]config.TestCase, len(testCases))
 	for _, testCase := range testCases {
-		if err := v.validateTestCase(testCase); err != nil {
-			return errors.Wrapf(err, "test case %s", testCase.Name)
+		byName[testCase.Name] = testCase
+	}
+	for _, testCase := range testCases {
+		defined := definedNames{local: maps.Clone(global), testCases: byName}
+		for name := range testCase.Variables {
+			defined.local[name] = struct{}{}
+		}
+
+		for _, problem := range v.validateTestCase(testCase, defined) {
+			problem.Err = errors.Wrapf(problem.Err, "test case %s", testCase.Name)
+			problems = append(problems, problem)
+		}
+		for _, problem := range validateOutputs(testCase, byName, defined.local) {
+			problem.Err = errors.Wrapf(problem.Err, "test case %s", testCase.Name)
+			problems = append(problems, problem)
 		}
 	}
 
+	if len(problems) > 0 {
+		return problems
+	}
+
 	return nil
 }
 
-func (v validator) validateTestCase(testCase config.TestCase) error {
-	for i, step := range testCase.Steps {
-		if err := v.validateStep(step); err != nil {
-			return errors.Wrapf(err, "step %d", i+1)
+// definedNames are names which can be referenced by a step besides variables of variables.yaml and --var
+type definedNames struct {
+	// local are variables of the example and values stored before the step
+	local map[string]struct{}
+	// testCases are referenced for their outputs, which are checked by validateOutputs
+	testCases map[string]config.TestCase
+}
+
+func (d definedNames) contains(name string) bool {
+	_, local := d.local[name]
+	_, testCase := d.testCases[name]
+
+	return local || testCase
+}
+
+// validateTestCase checks steps of the test case in order of their run, so each step can reference
+// values stored by earlier ones
+func (v validator) validateTestCase(testCase config.TestCase, defined definedNames) []ValidationError {
+	problems := v.validateSteps("setup step", testCase.Setup, defined)
+	problems = append(problems, v.validateSteps("step", testCase.Steps, defined)...)
+
+	return append(problems, v.validateSteps("teardown step", testCase.Teardown, defined)...)
+}
+
+// validateSteps checks the steps, values stored by each step are added to defined variables.
+// Problems are positioned at the keys they're about, or at the step.
+func (v validator) validateSteps(kind string, steps []config.Step, defined definedNames) []ValidationError {
+	var problems []ValidationError
+	for i, step := range steps {
+		for _, problem := range v.validateStep(step, defined) {
+			path := ""
+			var located *pathError
+			if errors.As(problem, &located) {
+				path = located.path
+			}
+
+			problems = append(problems, ValidationError{
+				Position: step.Positions.Find(path),
+				Err:      errors.Wrapf(problem, "%s %d", kind, i+1),
+			})
 		}
 	}
 
-	return nil
+	return problems
+}
+
+// validateServices checks substitutions in metadata of services used by the test cases and global steps,
+// they're substituted once before the run, so only variables of variables.yaml and --var are defined for them.
+// Problems are positioned at the keys of metadata in services.yaml.
+func (v validator) validateServices(testCases config.TestCases) []ValidationError {
+	services := make(map[string]config.Service)
+	steps := append(append([]config.Step{}, v.global.Setup...), v.global.Teardown...)
+	for _, testCase := range testCases {
+		steps = append(steps, testCase.AllSteps()...)
+	}
+	for _, step := range steps {
+		services[step.ServiceName] = step.Service
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []ValidationError
+	for _, name := range names {
+		service := services[name]
+		keys := make([]string, 0, len(service.Metadata))
+		for key := range service.Metadata {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			for _, problem := range v.checkReferences(service.Metadata[key], definedNames{}) {
+				problems = append(problems, ValidationError{
+					Position: service.Positions.Find("metadata." + key),
+					Err:      errors.Wrapf(problem, "service %s: metadata %s", name, key),
+				})
+			}
+		}
+	}
+
+	return problems
 }
 
-func (v validator) validateStep(step config.Step) error {
+func (v validator) validateStep(step config.Step, defined definedNames) []error {
+	problems := v.validateReferences(step, defined)
+	if step.Status != nil {
+		problems = append(problems, validateCode("status.code", step.Status.Code)...)
+	}
+
 	fullName := step.BuildProtoFullName()
 	descriptor := v.manager.GetDescriptor(fullName)
 
-	if err := v.validateRequest(step.ServiceName, descriptor.Input(), step.Request); err != nil {
-		return errors.Wrap(err, "request")
+	if len(step.Conversation) > 0 {
+		return append(problems, v.validateConversation(step, descriptor)...)
+	}
+
+	validateRequest := v.validateRequest
+	if descriptor.IsStreamingClient() {
+		validateRequest = v.validateStreamRequest
+	}
+	if err := validateRequest(step.ServiceName, descriptor.Input(), step.Request); err != nil {
+		problems = append(problems, inSource("request", "request", err))
+	}
+
+	validateResponse := v.validateResponse
+	if descriptor.IsStreamingServer() {
+		validateResponse = v.validateStreamResponse
+	}
+	for _, problem := range validateResponse(descriptor.Output(), step.Response) {
+		problems = append(problems, inSource("response", "response", problem))
+	}
+
+	if step.Snapshot != nil && step.Snapshot.Enabled && descriptor.IsStreamingServer() {
+		problems = append(problems, &pathError{path: "snapshot", err: errors.New("snapshot is supported only for unary responses")})
 	}
 
-	if err := v.validateResponse(descriptor.Output().Fields(), step.Response); err != nil {
-		return errors.Wrap(err, "response")
+	return append(problems, v.validateStepMetadata(step)...)
+}
+
+func (v validator) validateStepMetadata(step config.Step) []error {
+	var problems []error
+	for _, problem := range v.validateMetadata(step.Headers) {
+		problems = append(problems, inSource("headers", "headers", problem))
+	}
+	for _, problem := range v.validateMetadata(step.Trailers) {
+		problems = append(problems, inSource("trailers", "trailers", problem))
+	}
+
+	return problems
+}
+
+// validateCode checks expected status code, which is a name or a number of the code,
+// or functions one_of, not and store
+func validateCode(path string, expectation any) []error {
+	switch t := expectation.(type) {
+	case nil:
+		return nil
+	case string:
+		if _, ok := parseCode(t); !ok && !isSubstituted(t) {
+			return []error{problemAt(path, "unknown status code %s", t)}
+		}
+	case float64:
+		if _, ok := numericCode(t); !ok {
+			return []error{problemAt(path, "unknown status code %v", t)}
+		}
+	case map[string]any:
+		var problems []error
+		for _, key := range sortedKeys(t) {
+			switch key {
+			case "one_of":
+				items, ok := t[key].([]any)
+				if !ok {
+					problems = append(problems, problemAtKey(path, key, "one_of should be an array"))
+				}
+				for _, item := range items {
+					problems = append(problems, validateCode(path, item)...)
+				}
+			case "not":
+				problems = append(problems, validateCode(path, t[key])...)
+			case "store":
+				if _, ok := t[key].(string); !ok {
+					problems = append(problems, problemAtKey(path, key, "store should be a name of variable"))
+				}
+			default:
+				problems = append(problems, problemAtKey(path, key, "unexpected key %s, only one_of, not and store can be used for status code", key))
+			}
+		}
+
+		return problems
+	default:
+		return []error{problemAt(path, "status code should be a name or a number")}
 	}
 
 	return nil
 }
 
+// validateConversation checks messages and expectations of the conversation against the bidirectional stream method
+func (v validator) validateConversation(step config.Step, descriptor protoreflect.MethodDescriptor) []error {
+	if !descriptor.IsStreamingClient() || !descriptor.IsStreamingServer() {
+		return []error{errors.New("conversation is supported only for bidirectional streams")}
+	}
+
+	var problems []error
+	if len(step.Request) > 0 || len(step.Response) > 0 {
+		problems = append(problems, errors.New("conversation can't be combined with request and response"))
+	}
+
+	for j, entry := range step.Conversation {
+		forms := 0
+		for _, set := range []bool{entry.Send != nil, entry.Expect != nil, entry.HalfClose, entry.ExpectClose} {
+			if set {
+				forms++
+			}
+		}
+		name := fmt.Sprintf("conversation[%d]", j)
+		if forms != 1 {
+			err := errors.Errorf("%s should have one of send, expect, half_close or expect_close", name)
+			problems = append(problems, &pathError{path: name, err: err})
+
+			continue
+		}
+
+		if entry.Send != nil {
+			if err := v.validateRequest(step.ServiceName, descriptor.Input(), entry.Send); err != nil {
+				problems = append(problems, inSource(name+".send", name, err))
+			}
+		}
+		for _, problem := range v.validateResponse(descriptor.Output(), entry.Expect) {
+			problems = append(problems, inSource(name+".expect", name, problem))
+		}
+	}
+
+	return append(problems, v.validateStepMetadata(step)...)
+}
+
+// validateReferences checks substitutions of the step in order of their use. Expressions are parsed, references
+// should be well-formed and name variables of variables.yaml, --var, the example or values stored before.
+// Values stored by the step are added to defined variables, stored by expected messages of conversation
+// are available to next entries of the conversation.
+func (v validator) validateReferences(step config.Step, defined definedNames) []error {
+	var problems []error
+	check := func(path, name string, source json.RawMessage) {
+		parsed, err := parseSource(source)
+		if err != nil {
+			problems = append(problems, inSource(path, name, err))
+
+			return
+		}
+
+		walkStringPaths(parsed, path, func(path string, value string) {
+			for _, problem := range v.checkReferences(value, defined) {
+				problems = append(problems, &pathError{path: path, err: errors.Wrap(problem, name)})
+			}
+		})
+	}
+	store := func(source json.RawMessage) {
+		if parsed, err := parseSource(source); err == nil {
+			collectStored(parsed, defined.local)
+		}
+	}
+
+	keys := make([]string, 0, len(step.Metadata))
+	for key := range step.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, problem := range v.checkReferences(step.Metadata[key], defined) {
+			problems = append(problems, &pathError{path: "metadata." + key, err: errors.Wrapf(problem, "metadata %s", key)})
+		}
+	}
+
+	check("request", "request", step.Request)
+	for j, entry := range step.Conversation {
+		name := fmt.Sprintf("conversation[%d]", j)
+		check(name+".send", name, entry.Send)
+		check(name+".expect", name, entry.Expect)
+		store(entry.Expect)
+	}
+	check("response", "response", step.Response)
+	check("headers", "headers", step.Headers)
+	check("trailers", "trailers", step.Trailers)
+
+	for _, source := range []json.RawMessage{step.Response, step.Headers, step.Trailers} {
+		store(source)
+	}
+	if step.Status != nil {
+		collectStored([]any{step.Status.Code, step.Status.Message, step.Status.Details}, defined.local)
+	}
+
+	return problems
+}
+
+// checkReferences returns problems of substitutions of the string, empty defined names mean that only variables
+// of variables.yaml and --var can be referenced
+func (v validator) checkReferences(source string, defined definedNames) []error {
+	var problems []error
+	if _, err := checkSubstitutions(source); err != nil {
+		problems = append(problems, err)
+	}
+
+	for _, match := range substitutionRegExp.FindAllStringSubmatch(source, -1) {
+		reference := match[2] + match[3]
+		if reference == "" || !referenceRegExp.MatchString(reference) {
+			continue
+		}
+
+		name := reference
+		if i := strings.IndexAny(reference, ".["); i >= 0 {
+			name = reference[:i]
+		}
+		if defined.contains(name) {
+			continue
+		}
+		if _, ok := v.variables.Get(name); !ok {
+			problems = append(problems, errors.Errorf("variable %s is not defined in variables.yaml, --var or stored before", name))
+		}
+	}
+
+	return problems
+}
+
+// collectStored adds names of values stored by the expectations to the set
+func collectStored(expectations any, names map[string]struct{}) {
+	switch t := expectations.(type) {
+	case map[string]any:
+		for key, item := range t {
+			if name, ok := item.(string); ok && key == "store" {
+				names[name] = struct{}{}
+
+				continue
+			}
+
+			collectStored(item, names)
+		}
+	case []any:
+		for _, item := range t {
+			collectStored(item, names)
+		}
+	}
+}
+
+// parseSource parses json block of the step, empty block is parsed as nil
+func parseSource(source json.RawMessage) (any, error) {
+	if len(source) == 0 {
+		return nil, nil
+	}
+
+	var parsed any
+	if err := json.Unmarshal(source, &parsed); err != nil {
+		return nil, err
+	}
+
+	return parsed, nil
+}
+
+// validateOutputs checks that the test case references outputs only of test cases it depends on,
+// local variables named like test cases shadow them. Problems are positioned at the referencing step.
+func validateOutputs(testCase config.TestCase, byName map[string]config.TestCase, local map[string]struct{}) []ValidationError {
+	dependencies := make(map[string]struct{})
+	collectDependencies(testCase, byName, dependencies)
+
+	var problems []ValidationError
+	steps := append(append(append([]config.Step{}, testCase.Setup...), testCase.Steps...), testCase.Teardown...)
+	for _, step := range steps {
+		position := step.Position()
+		if !position.IsKnown() {
+			position = testCase.Position
+		}
+
+		var references []string
+		collect := func(source string) (any, error) {
+			for _, match := range substitutionRegExp.FindAllStringSubmatch(source, -1) {
+				if match[2] != "" {
+					references = append(references, match[2])
+				}
+			}
+
+			return source, nil
+		}
+		if err := walkStepStrings(step, collect); err != nil {
+			problems = append(problems, ValidationError{Position: position, Err: err})
+
+			continue
+		}
+
+		for _, reference := range references {
+			if err := checkOutputReference(reference, byName, dependencies, local); err != nil {
+				problems = append(problems, ValidationError{Position: position, Err: err})
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkOutputReference checks that the reference to outputs of another test case is declared by it
+// and the test case is a dependency
+func checkOutputReference(
+	reference string, byName map[string]config.TestCase, dependencies, local map[string]struct{},
+) error {
+	name, output, _ := strings.Cut(reference, ".")
+	source, ok := byName[name]
+	if _, shadowed := local[name]; !ok || shadowed {
+		return nil
+	}
+	if _, ok := dependencies[name]; !ok {
+		return errors.Errorf("${%s} references test case %s which is not in depends_on", reference, name)
+	}
+	if i := strings.IndexAny(output, ".["); i >= 0 {
+		output = output[:i]
+	}
+	if !slices.Contains(source.Outputs, output) {
+		return errors.Errorf("${%s} references %s which is not in outputs of test case %s", reference, output, name)
+	}
+
+	return nil
+}
+
+// collectDependencies adds direct and transitive dependencies of the test case to the set
+func collectDependencies(testCase config.TestCase, byName map[string]config.TestCase, dependencies map[string]struct{}) {
+	for _, name := range testCase.DependsOn {
+		if _, ok := dependencies[name]; ok {
+			continue
+		}
+
+		dependencies[name] = struct{}{}
+		collectDependencies(byName[name], byName, dependencies)
+	}
+}
+
+// stepSource is a json block of the step, like request or expectation of conversation message
+type stepSource struct {
+	name   string
+	source json.RawMessage
+}
+
+// walkStepStrings calls the function for strings of the request, expectations and metadata of the step
+func walkStepStrings(step config.Step, fn func(string) (any, error)) error {
+	sources := []stepSource{
+		{name: "request", source: step.Request},
+		{name: "response", source: step.Response},
+		{name: "headers", source: step.Headers},
+		{name: "trailers", source: step.Trailers},
+	}
+	for j, entry := range step.Conversation {
+		name := fmt.Sprintf("conversation[%d]", j)
+		sources = append(sources, stepSource{name: name, source: entry.Send}, stepSource{name: name, source: entry.Expect})
+	}
+	for _, source := range sources {
+		parsed, err := parseSource(source.source)
+		if err != nil {
+			return errors.Wrap(err, source.name)
+		}
+		if _, err := walkStrings(parsed, fn); err != nil {
+			return errors.Wrap(err, source.name)
+		}
+	}
+
+	for key, value := range step.Metadata {
+		if _, err := fn(value); err != nil {
+			return errors.Wrapf(err, "metadata %s", key)
+		}
+	}
+
+	return nil
+}
+
+// validateMetadata checks expectations of headers or trailers, keys are names of metadata or functions
+func (v validator) validateMetadata(expectations json.RawMessage) []error {
+	if len(expectations) == 0 {
+		return nil
+	}
+
+	var expectationsMap map[string]any
+	if err := json.Unmarshal(expectations, &expectationsMap); err != nil {
+		return []error{errors.Wrap(err, "error on unmarshalling expectations")}
+	}
+
+	validator := newResponseValidator(v.checker.FunctionExists)
+	var problems []error
+	for _, key := range sortedKeys(expectationsMap) {
+		if validator.check(key) {
+			problems = append(problems, validator.validateMetadataFunction("", key, expectationsMap[key])...)
+
+			continue
+		}
+
+		problems = append(problems, validator.validateMetadataValue(key, expectationsMap[key])...)
+	}
+
+	return problems
+}
+
 func (v validator) validateRequest(service string, input protoreflect.MessageDescriptor, request json.RawMessage) error {
 	_, err := v.clientsManager.GetClient(service).BuildRequest(input, request)
 	if err != nil {
@@ -67,7 +598,26 @@ func (v validator) validateRequest(service string, input protoreflect.MessageDes
 	return nil
 }
 
-func (v validator) validateResponse(fields protoreflect.FieldDescriptors, response json.RawMessage) error {
+// validateStreamRequest checks each message of the client stream request, which is an array of messages
+func (v validator) validateStreamRequest(service string, input protoreflect.MessageDescriptor, request json.RawMessage) error {
+	if len(request) == 0 {
+		return nil
+	}
+
+	var messages []json.RawMessage
+	if err := json.Unmarshal(request, &messages); err != nil {
+		return errors.New("array of messages was expected for client stream")
+	}
+	for i, message := range messages {
+		if err := v.validateRequest(service, input, message); err != nil {
+			return errors.Wrapf(err, "message %d", i+1)
+		}
+	}
+
+	return nil
+}
+
+func (v validator) validateResponse(output protoreflect.MessageDescriptor, response json.RawMessage) []error {
 	if len(response) == 0 {
 		return nil
 	}
@@ -75,12 +625,135 @@ func (v validator) validateResponse(fields protoreflect.FieldDescriptors, respon
 	var responseMap map[string]any
 	err := json.Unmarshal(response, &responseMap)
 	if err != nil {
-		return errors.Wrap(err, "error on unmarshalling response")
+		return []error{errors.Wrap(err, "error on unmarshalling response")}
+	}
+
+	return newResponseValidator(v.checker.FunctionExists).validate(output, responseMap)
+}
+
+// validateStreamResponse checks stream expectations and each expected message of the server stream
+func (v validator) validateStreamResponse(output protoreflect.MessageDescriptor, response json.RawMessage) []error {
+	if len(response) == 0 {
+		return nil
+	}
+
+	var responseMap map[string]any
+	if err := json.Unmarshal(response, &responseMap); err != nil {
+		return []error{errors.Wrap(err, "error on unmarshalling response")}
+	}
+
+	stream, err := newStreamExpectations(responseMap)
+	if err != nil {
+		return []error{err}
+	}
+
+	validator := newResponseValidator(v.checker.FunctionExists)
+	var problems []error
+	if stream.count != nil {
+		problems = append(problems, validator.validateNumber("", "count", stream.count)...)
+	}
+	for i, message := range stream.messages {
+		problems = append(problems, validator.validateMessage(fmt.Sprintf("stream[%d]", i), messageTarget(output), message)...)
+	}
+	for _, name := range []string{"any_message", "all_messages", "last"} {
+		if message, ok := responseMap[name].(map[string]any); ok {
+			problems = append(problems, validator.validateMessage(name, messageTarget(output), message)...)
+		}
+	}
+
+	return problems
+}
+
+// opaqueMessages are well-known types which json form has arbitrary keys, their expectations aren't checked
+var opaqueMessages = map[protoreflect.FullName]struct{}{
+	"google.protobuf.Any": {}, "google.protobuf.Struct": {}, "google.protobuf.Value": {}, "google.protobuf.ListValue": {},
+}
+
+// numericWrappers are well-known types which json form is a number
+var numericWrappers = map[protoreflect.FullName]struct{}{
+	"google.protobuf.DoubleValue": {}, "google.protobuf.FloatValue": {}, "google.protobuf.Int64Value": {},
+	"google.protobuf.UInt64Value": {}, "google.protobuf.Int32Value": {}, "google.protobuf.UInt32Value": {},
+}
+
+// expectationTarget is a value expectations are written for: the response message, a field or an element
+// of repeated or map field
+type expectationTarget struct {
+	// field is nil for the response message
+	field protoreflect.FieldDescriptor
+	// message is set if the target is a message
+	message protoreflect.MessageDescriptor
+	// collection is set if the target is a whole repeated or map field
+	collection bool
+}
+
+func messageTarget(message protoreflect.MessageDescriptor) expectationTarget {
+	return expectationTarget{message: message}
+}
+
+func fieldTarget(field protoreflect.FieldDescriptor) expectationTarget {
+	if field.IsList() || field.IsMap() {
+		return expectationTarget{field: field, collection: true}
+	}
+
+	return expectationTarget{field: field, message: field.Message()}
+}
+
+// element returns target of elements of repeated field or values of map field
+func (t expectationTarget) element() expectationTarget {
+	field := t.field
+	if field.IsMap() {
+		field = field.MapValue()
+	}
+
+	return expectationTarget{field: field, message: field.Message()}
+}
+
+func (t expectationTarget) isList() bool {
+	return t.collection && !t.field.IsMap()
+}
+
+// isOpaque reports whether keys of the target can't be checked
+func (t expectationTarget) isOpaque() bool {
+	if t.message == nil {
+		return false
+	}
+	_, ok := opaqueMessages[t.message.FullName()]
+
+	return ok
+}
+
+// isStructured reports whether keys of the target are fields of the message
+func (t expectationTarget) isStructured() bool {
+	return t.message != nil && !strings.HasPrefix(string(t.message.FullName()), "google.protobuf.")
+}
+
+// isOrdered reports whether the target supports gt, gte, lt and lte functions
+func (t expectationTarget) isOrdered() bool {
+	if t.field == nil || t.collection {
+		return false
+	}
+	if t.message != nil {
+		_, numeric := numericWrappers[t.message.FullName()]
+
+		return numeric || t.isTemporal()
 	}
 
-	return newResponseValidator(v.checker.FunctionExists).validate(fields, responseMap)
+	switch t.field.Kind() { //nolint:exhaustive
+	case protoreflect.BoolKind, protoreflect.StringKind, protoreflect.BytesKind:
+		return false
+	default:
+		return true
+	}
+}
+
+// isTemporal reports whether the target is a timestamp or duration
+func (t expectationTarget) isTemporal() bool {
+	return t.message != nil &&
+		(t.message.FullName() == "google.protobuf.Timestamp" || t.message.FullName() == "google.protobuf.Duration")
 }
 
+// responseValidator checks expectations against the descriptor of the response message, all keys are checked
+// including keys of nested messages, elements of repeated fields and values of map fields
 type responseValidator struct {
 	check func(function string) bool
 }
@@ -89,35 +762,345 @@ func newResponseValidator(check func(function string) bool) responseValidator {
 	return responseValidator{check: check}
 }
 
-func (v responseValidator) validate(fields protoreflect.FieldDescriptors, response map[string]any) error {
-	for key, value := range response {
-		field := fields.ByJSONName(key)
-		if field == nil && !v.check(key) {
-			return fmt.Errorf("unexpected key %s", key)
+func (v responseValidator) validate(message protoreflect.MessageDescriptor, response map[string]any) []error {
+	return v.validateMessage("", messageTarget(message), response)
+}
+
+// validateMessage checks that keys of expectations are functions or fields of the message,
+// fields of the same oneof can't be expected together
+func (v responseValidator) validateMessage(path string, target expectationTarget, expectations map[string]any) []error {
+	var problems []error
+	oneofs := make(map[protoreflect.FullName]string)
+	for _, key := range sortedKeys(expectations) {
+		value := expectations[key]
+		if v.check(key) {
+			problems = append(problems, v.validateFunction(path, key, value, target)...)
+
+			continue
 		}
-		if field != nil && field.Kind() == protoreflect.MessageKind {
-			fields = field.Message().Fields()
+
+		field := target.message.Fields().ByJSONName(key)
+		if field == nil {
+			problems = append(problems, v.unexpectedKey(path, key, target.message))
+
+			continue
 		}
 
-		return v.validateValue(fields, value)
+		if oneof := field.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			if other, ok := oneofs[oneof.FullName()]; ok {
+				problems = append(problems, problemAtKey(path, key, "%s and %s are fields of oneof %s, only one of them can be set",
+					other, key, oneof.Name()))
+			}
+			oneofs[oneof.FullName()] = key
+		}
 
+		problems = append(problems, v.validateValue(joinPath(path, key), fieldTarget(field), value)...)
 	}
 
-	return nil
+	return problems
+}
+
+func (v responseValidator) unexpectedKey(path string, key string, message protoreflect.MessageDescriptor) error {
+	if field := message.Fields().ByName(protoreflect.Name(key)); field != nil {
+		return problemAtKey(path, key, "unexpected key %s, field is named %s in responses", key, field.JSONName())
+	}
+
+	return problemAtKey(path, key, "unexpected key %s, it's neither a field of %s nor a function", key, message.FullName())
 }
 
-func (v responseValidator) validateValue(fields protoreflect.FieldDescriptors, value any) error {
+func (v responseValidator) validateValue(path string, target expectationTarget, value any) []error {
 	switch t := value.(type) {
 	case map[string]any:
-		return v.validate(fields, t)
+		switch {
+		case target.isOpaque():
+			return nil
+		case target.isStructured() && !target.collection:
+			return v.validateMessage(path, target, t)
+		}
+
+		var problems []error
+		for _, key := range sortedKeys(t) {
+			switch {
+			case v.check(key):
+				problems = append(problems, v.validateFunction(path, key, t[key], target)...)
+			case target.collection && target.field.IsMap():
+				problems = append(problems, v.validateValue(joinPath(path, key), target.element(), t[key])...)
+			case target.isList():
+				problems = append(problems, problemAtKey(path, key, "unexpected key %s, repeated field expects an array or functions", key))
+			default:
+				problems = append(problems, problemAtKey(path, key, "unexpected key %s, only functions can be used for the field", key))
+			}
+		}
+
+		return problems
 	case []any:
-		for _, item := range t {
-			err := v.validateValue(fields, item)
-			if err != nil {
-				return err
+		if target.isList() {
+			var problems []error
+			for i, item := range t {
+				problems = append(problems, v.validateValue(fmt.Sprintf("%s[%d]", path, i), target.element(), item)...)
 			}
+
+			return problems
+		}
+		if !target.isOpaque() {
+			return []error{problemAt(path, "array was expected only for repeated field")}
 		}
 	}
 
 	return nil
 }
+
+// validateFunction checks that the function supports the target and its argument has the expected type.
+// Arguments which are variables or expressions are checked only after substitution during the run.
+func (v responseValidator) validateFunction(path string, function string, argument any, target expectationTarget) []error {
+	if value, ok := argument.(string); ok && isSubstituted(value) && function != "store" {
+		return nil
+	}
+
+	switch function {
+	case "len":
+		if !target.isList() {
+			return []error{problemAtKey(path, function, "len is supported only for repeated fields")}
+		}
+
+		return v.validateNumber(path, function, argument)
+	case "gt", "gte", "lt", "lte":
+		if !target.isOrdered() {
+			return []error{problemAtKey(path, function, "%s is supported only for numbers, enums, timestamps and durations", function)}
+		}
+
+		return validateOrdered(path, function, argument)
+	case "within":
+		if !target.isTemporal() {
+			return []error{problemAtKey(path, function, "within is supported only for timestamps and durations")}
+		}
+		if _, _, err := parseWithin(argument); err != nil {
+			return []error{problemAtKey(path, function, "within: %s", err.Error())}
+		}
+	case "one_of":
+		items, ok := argument.([]any)
+		if !ok {
+			return []error{problemAtKey(path, function, "one_of should be an array")}
+		}
+
+		var problems []error
+		for _, item := range items {
+			problems = append(problems, v.validateValue(path, target, item)...)
+		}
+
+		return problems
+	case "any", "first", "all":
+		if !target.isList() {
+			return []error{problemAtKey(path, function, "%s is supported only for repeated fields", function)}
+		}
+
+		return v.validateValue(path, target.element(), argument)
+	case "store":
+		if _, ok := argument.(string); !ok {
+			return []error{problemAtKey(path, function, "store should be a name of variable")}
+		}
+	case "not":
+		return v.validateValue(path, target, argument)
+	}
+
+	return nil
+}
+
+// validateMetadataValue checks expectation of the metadata key, which value is a string,
+// or an array of strings if the key has several values
+func (v responseValidator) validateMetadataValue(path string, value any) []error {
+	switch t := value.(type) {
+	case string:
+		return nil
+	case []any:
+		var problems []error
+		for i, item := range t {
+			if _, ok := item.(string); !ok {
+				problems = append(problems, problemAt(fmt.Sprintf("%s[%d]", path, i), "string was expected, metadata values are strings"))
+			}
+		}
+
+		return problems
+	case map[string]any:
+		var problems []error
+		for _, key := range sortedKeys(t) {
+			if !v.check(key) {
+				problems = append(problems, problemAtKey(path, key, "unexpected key %s, only functions can be used for metadata", key))
+
+				continue
+			}
+
+			problems = append(problems, v.validateMetadataFunction(path, key, t[key])...)
+		}
+
+		return problems
+	default:
+		return []error{problemAt(path, "string was expected, metadata values are strings")}
+	}
+}
+
+// validateMetadataFunction checks that the function supports values of metadata and its argument has the expected type
+func (v responseValidator) validateMetadataFunction(path string, function string, argument any) []error {
+	if value, ok := argument.(string); ok && isSubstituted(value) && function != "store" {
+		return nil
+	}
+
+	switch function {
+	case "len":
+		return v.validateNumber(path, function, argument)
+	case "gt", "gte", "lt", "lte", "within":
+		return []error{problemAtKey(path, function, "%s is not supported for metadata, its values are strings", function)}
+	case "one_of":
+		items, ok := argument.([]any)
+		if !ok {
+			return []error{problemAtKey(path, function, "one_of should be an array")}
+		}
+
+		var problems []error
+		for _, item := range items {
+			problems = append(problems, v.validateMetadataValue(path, item)...)
+		}
+
+		return problems
+	case "any", "first", "all", "not":
+		return v.validateMetadataValue(path, argument)
+	case "store":
+		if _, ok := argument.(string); !ok {
+			return []error{problemAtKey(path, function, "store should be a name of variable")}
+		}
+	}
+
+	return nil
+}
+
+// validateNumber checks argument of len or count, which is a number or functions of the number like `gte: 10`
+func (v responseValidator) validateNumber(path string, function string, argument any) []error {
+	switch t := argument.(type) {
+	case float64:
+		return nil
+	case map[string]any:
+		if len(t) == 0 {
+			return []error{problemAtKey(path, function, "%s should have functions", function)}
+		}
+
+		var problems []error
+		for _, key := range sortedKeys(t) {
+			switch {
+			case !v.check(key):
+				problems = append(problems, problemAtKey(path, function, "%s: unknown function %s", function, key))
+			case key == "gt" || key == "gte" || key == "lt" || key == "lte":
+				problems = append(problems, validateOrdered(path, key, t[key])...)
+			case key == "not":
+				problems = append(problems, v.validateNumber(path, function, t[key])...)
+			case key == "one_of":
+				if _, ok := t[key].([]any); !ok {
+					problems = append(problems, problemAtKey(path, function, "one_of should be an array"))
+				}
+			}
+		}
+
+		return problems
+	case string:
+		if isSubstituted(t) {
+			return nil
+		}
+	}
+
+	return []error{problemAtKey(path, function, "%s should be a number or functions of the number", function)}
+}
+
+func validateOrdered(path string, function string, argument any) []error {
+	switch t := argument.(type) {
+	case float64:
+		return nil
+	case string:
+		// timestamps, durations and enums are compared with strings
+		if t != "" {
+			return nil
+		}
+	}
+
+	return []error{problemAtKey(path, function, "%s should be a number, or a string for timestamps, durations and enums", function)}
+}
+
+// pathError is a problem at the path of expectations, like items[0].sku, or at the path of the step,
+// like response.items[0].sku. The path is used to find position of the problem.
+type pathError struct {
+	path string
+	err  error
+}
+
+func (e *pathError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pathError) Unwrap() error {
+	return e.err
+}
+
+// problemAt returns the problem of the field at the path, empty path is the response message itself
+func problemAt(path string, format string, args ...any) error {
+	return &pathError{path: path, err: fieldProblem(path, format, args...)}
+}
+
+// problemAtKey returns the problem of the key of the field at the path, it's positioned at the key
+func problemAtKey(path, key string, format string, args ...any) error {
+	return &pathError{path: joinPath(path, key), err: fieldProblem(path, format, args...)}
+}
+
+func fieldProblem(path string, format string, args ...any) error {
+	if path == "" {
+		return errors.Errorf(format, args...)
+	}
+
+	return errors.Errorf("%s: "+format, append([]any{path}, args...)...)
+}
+
+// inSource returns the problem of the json block of the step, like response, wrapped with its name.
+// Path of the problem is prefixed with the path of the block.
+func inSource(source, name string, problem error) error {
+	path := source
+	var located *pathError
+	if errors.As(problem, &located) {
+		path = source + "." + located.path
+		if located.path == "" || strings.HasPrefix(located.path, "[") {
+			path = source + located.path
+		}
+	}
+
+	return &pathError{path: path, err: errors.Wrap(problem, name)}
+}
+
+// walkStringPaths calls the function for each string of the parsed json with its path, like items[0].sku
+func walkStringPaths(value any, path string, fn func(path string, value string)) {
+	switch t := value.(type) {
+	case string:
+		fn(path, t)
+	case map[string]any:
+		for _, key := range sortedKeys(t) {
+			walkStringPaths(t[key], joinPath(path, key), fn)
+		}
+	case []any:
+		for i, item := range t {
+			walkStringPaths(item, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func sortedKeys(values map[string]any) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
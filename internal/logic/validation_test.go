@@ -0,0 +1,215 @@
+package logic_test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/logic"
+	"github.com/res-am/grpc-fts/internal/proto"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const shopProto = `
+name: "shop.proto" package: "shop" syntax: "proto3" dependency: "google/protobuf/timestamp.proto"
+message_type {
+  name: "Order"
+  field { name: "id" number: 1 type: TYPE_STRING json_name: "id" }
+  field { name: "items" number: 2 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".shop.Item" json_name: "items" }
+  field { name: "labels" number: 3 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".shop.Order.LabelsEntry" json_name: "labels" }
+  field { name: "card" number: 4 type: TYPE_STRING oneof_index: 0 json_name: "card" }
+  field { name: "cash" number: 5 type: TYPE_BOOL oneof_index: 0 json_name: "cash" }
+  field { name: "created_at" number: 6 type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" json_name: "createdAt" }
+  nested_type {
+    name: "LabelsEntry" options { map_entry: true }
+    field { name: "key" number: 1 type: TYPE_STRING json_name: "key" }
+    field { name: "value" number: 2 type: TYPE_MESSAGE type_name: ".shop.Item" json_name: "value" }
+  }
+  oneof_decl { name: "payment" }
+}
+message_type {
+  name: "Item"
+  field { name: "sku" number: 1 type: TYPE_STRING json_name: "sku" }
+  field { name: "quantity" number: 2 type: TYPE_INT32 json_name: "quantity" }
+}
+service { name: "Shop" method { name: "GetOrder" input_type: ".shop.Order" output_type: ".shop.Order" } }
+`
+
+type shopDescriptors struct {
+	service protoreflect.ServiceDescriptor
+}
+
+func (m shopDescriptors) GetDescriptor(name protoreflect.FullName) protoreflect.MethodDescriptor {
+	return m.service.Methods().ByName(name.Name())
+}
+
+func (m shopDescriptors) Resolver() proto.Resolver {
+	return protoregistry.GlobalTypes
+}
+
+func (m shopDescriptors) Close() error {
+	return nil
+}
+
+func newShopDescriptors(t *testing.T) shopDescriptors {
+	var file descriptorpb.FileDescriptorProto
+	if err := prototext.Unmarshal([]byte(shopProto), &file); err != nil {
+		t.Fatal(err)
+	}
+	descriptor, err := protodesc.NewFile(&file, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return shopDescriptors{service: descriptor.Services().ByName("Shop")}
+}
+
+func shopStep(request string, response string) config.Step {
+	return config.Step{
+		ServiceName: "shop", Method: "GetOrder", Request: []byte(request), Response: []byte(response),
+		Service: config.Service{Service: "shop.Shop", Metadata: map[string]string{"authorization": "$token"}},
+	}
+}
+
+func statusStep(code any) config.Step {
+	step := shopStep(`{}`, "")
+	step.Status = &config.Status{Code: code}
+
+	return step
+}
+
+func metadataStep(headers string) config.Step {
+	step := shopStep(`{}`, "")
+	step.Headers = []byte(headers)
+
+	return step
+}
+
+func TestValidator_Validate(t *testing.T) {
+	ctx := newRunContext(t, "--var", "order_id=o1")
+	variables, err := logic.NewVariables(ctx)
+	assert.NoError(t, err)
+	validator := logic.NewValidator(
+		echoClientsManager{}, newShopDescriptors(t), logic.NewResponseChecker(variables), &config.Global{}, variables,
+	)
+
+	err = validator.Validate(config.TestCases{{
+		Name: "order",
+		Steps: []config.Step{
+			shopStep(`{"id": "$order_id"}`, `{
+				"id": {"store": "order"},
+				"items": {"len": "many", "any": {"sku": "a1", "qty": 1}},
+				"labels": {"gift": {"sku": "a2", "price": 1}},
+				"card": "4242",
+				"cash": true,
+				"created_at": {"within": "5m of now"},
+				"createdAt": {"within": "5m"}
+			}`),
+			shopStep(`{"id": "${order}"}`, `{
+				"id": {"one_of": "o1"},
+				"items": [{"sku": "a1"}, {"size": 1}],
+				"card": {"gt": 1}
+			}`),
+			shopStep(`{"id": "$missing"}`, `{"id": "${order}"}`),
+			statusStep(map[string]any{"one_of": []any{"NOT_FOUND", float64(5), float64(42)}}),
+			metadataStep(`{"x-version": {"gt": 1, "one_of": ["1", 2]}, "x-id": {"exists": true}, "x-tags": {"len": 2}}`),
+		},
+	}})
+
+	var problems logic.ValidationErrors
+	if assert.True(t, errors.As(err, &problems)) {
+		assert.Len(t, problems, 15)
+	}
+	for _, problem := range []string{
+		"service shop: metadata authorization: variable token is not defined",
+		"test case order: step 1: response: card and cash are fields of oneof payment",
+		"step 1: response: createdAt: within: invalid expectation 5m",
+		"step 1: response: items: len should be a number or functions of the number",
+		"step 1: response: items: unexpected key qty, it's neither a field of shop.Item nor a function",
+		"step 1: response: labels.gift: unexpected key price",
+		"step 1: response: unexpected key created_at, field is named createdAt in responses",
+		"step 2: response: card: gt is supported only for numbers, enums, timestamps and durations",
+		"step 2: response: id: one_of should be an array",
+		"step 2: response: items[1]: unexpected key size",
+		"step 3: request: variable missing is not defined in variables.yaml, --var or stored before",
+		"step 4: status.code: unknown status code 42",
+		"step 5: headers: x-id: unexpected key exists, only functions can be used for metadata",
+		"step 5: headers: x-version: gt is not supported for metadata, its values are strings",
+		"step 5: headers: x-version: string was expected, metadata values are strings",
+	} {
+		assert.ErrorContains(t, err, problem)
+	}
+}
+
+const orderTestCase = `steps:
+  - service: shop
+    method: GetOrder
+    request:
+      id: $missing
+    response:
+      items:
+        - sku: a1
+          qty: 1
+`
+
+func TestValidator_Validate_Positions(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "test-cases"), os.ModePerm))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test-cases", "order.yaml"), []byte(orderTestCase), 0o600))
+	ctx := newRunContext(t, "--configs", dir)
+	variables, err := logic.NewVariables(ctx)
+	assert.NoError(t, err)
+	services := config.Services{"shop": config.Service{Service: "shop.Shop"}}
+	testCases, err := config.NewTestCases(ctx, logrus.NewEntry(logrus.New()), services)
+	assert.NoError(t, err)
+	validator := logic.NewValidator(
+		echoClientsManager{}, newShopDescriptors(t), logic.NewResponseChecker(variables), &config.Global{}, variables,
+	)
+
+	err = validator.Validate(testCases)
+
+	file := filepath.Join(dir, "test-cases", "order.yaml")
+	assert.ErrorContains(t, err, file+":5:7: test case order: step 1: request: variable missing is not defined")
+	assert.ErrorContains(t, err, file+":9:11: test case order: step 1: response: items[0]: unexpected key qty")
+
+	var problems logic.ValidationErrors
+	if assert.True(t, errors.As(err, &problems)) {
+		var output bytes.Buffer
+		assert.NoError(t, logic.WriteGithubAnnotations(&output, problems))
+		assert.Contains(t, output.String(), "::error file="+file+",line=9,col=11::test case order: step 1: response: items[0]: unexpected key qty")
+	}
+}
+
+func TestValidator_Validate_Outputs(t *testing.T) {
+	variables, err := logic.NewVariables(newRunContext(t, "--var", "token=secret"))
+	assert.NoError(t, err)
+	validator := logic.NewValidator(
+		echoClientsManager{}, newShopDescriptors(t), logic.NewResponseChecker(variables), &config.Global{}, variables,
+	)
+
+	err = validator.Validate(config.TestCases{
+		{Name: "init", Outputs: []string{"order"}, Steps: []config.Step{shopStep(`{"id": "o1"}`, `{"id": {"store": "order"}}`)}},
+		{Name: "other", Steps: []config.Step{shopStep(`{"id": "o2"}`, ``)}},
+		{Name: "use", DependsOn: []string{"init", "missing"}, Steps: []config.Step{
+			shopStep(`{"id": "${init.id}"}`, ``),
+			shopStep(`{"id": "${other.order}"}`, ``),
+		}},
+	})
+
+	var problems logic.ValidationErrors
+	if assert.True(t, errors.As(err, &problems)) {
+		assert.Len(t, problems, 3)
+	}
+	assert.ErrorContains(t, err, "test case use depends on unknown test case missing")
+	assert.ErrorContains(t, err, "test case use: ${init.id} references id which is not in outputs of test case init")
+	assert.ErrorContains(t, err, "test case use: ${other.order} references test case other which is not in depends_on")
+}
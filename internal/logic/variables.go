@@ -2,118 +2,353 @@ package logic
 
 import (
 	"bytes"
-	"github.com/ghodss/yaml"
+	"encoding/json"
+	"fmt"
 	"github.com/pkg/errors"
 	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 var ErrVariableNotFound = errors.New("variable not found")
-var replacerRegExp = regexp.MustCompile(`\$\w+`)
 
-type Variables map[string]string
+// substitutionRegExp matches escaped dollars $$, expressions ${{ uuid() }}, references ${user.id}
+// and variables $name
+var substitutionRegExp = regexp.MustCompile(`\$\$|\$\{\{(.*?)\}\}|\$\{([^{}]*)\}|\$(\w+)`)
 
-func NewVariables(ctx config.ContextWrapper) (Variables, error) {
-	file, err := os.ReadFile(ctx.ConfigFlag() + "/variables.yaml")
-	if errors.Is(err, os.ErrNotExist) {
-		return make(Variables), nil
-	}
-	if err != nil {
-		return nil, errors.Wrap(err, "error reading service config")
-	}
+// referenceRegExp matches references to variables and their nested values, like user.addresses[0].id,
+// or to outputs of test cases, like create-user.id
+var referenceRegExp = regexp.MustCompile(`^[\w-]+(?:\.\w+|\[\d+\])*$`)
+var referenceSegmentRegExp = regexp.MustCompile(`\.(\w+)|\[(\d+)\]`)
 
-	variables := make(Variables)
-	err = yaml.Unmarshal(file, &variables)
-	if err != nil {
-		return nil, errors.Wrap(err, "error parsing service config")
+// Variables is safe for concurrent use, so test cases running in parallel can share it
+type Variables struct {
+	mu sync.RWMutex
+	// values are values of variables.yaml, --var strings or stored values of any json type
+	values map[string]any
+	// parent is set for scopes, variables not found in the scope are looked up in the parent
+	parent *Variables
+}
+
+func NewVariables(ctx config.ContextWrapper) (*Variables, error) {
+	values := make(map[string]any)
+	file, _, err := config.ReadLayered(ctx, "variables")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, errors.Wrap(err, "variables config")
 	}
-	if variables == nil {
-		variables = make(Variables)
+	if err == nil {
+		// numbers are kept as is, so big integers don't lose precision
+		decoder := json.NewDecoder(bytes.NewReader(file))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			files := strings.Join(config.LayerFiles(ctx, "variables"), ", ")
+
+			return nil, models.NewErr(fmt.Sprintf("error parsing %s: %s", files, err.Error()))
+		}
+		if values == nil {
+			values = make(map[string]any)
+		}
 	}
 
 	for _, variable := range ctx.VarFlag() {
 		kv := strings.SplitN(variable, "=", 2)
-		variables[kv[0]] = kv[1]
+		values[kv[0]] = kv[1]
 	}
 
-	return variables, nil
+	return &Variables{values: values}, nil
 }
 
-func (v Variables) ReplaceServicesMetadata(services config.Services) error {
-	for key := range services {
-		err := v.ReplaceMap(services[key].Metadata)
-		if err != nil {
-			return errors.Wrap(err, "error replacing services metadata")
+// With returns a scope with the given values over the variables. Values set to the scope stay in it,
+// so test cases don't overwrite values of each other
+func (v *Variables) With(values map[string]any) *Variables {
+	scope := make(map[string]any, len(values))
+	for name, value := range values {
+		scope[name] = value
+	}
+
+	return &Variables{values: scope, parent: v}
+}
+
+func (v *Variables) Get(name string) (any, bool) {
+	v.mu.RLock()
+	value, ok := v.values[name]
+	v.mu.RUnlock()
+
+	if !ok && v.parent != nil {
+		return v.parent.Get(name)
+	}
+
+	return value, ok
+}
+
+func (v *Variables) Set(name string, value any) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.values[name] = value
+}
+
+func (v *Variables) SetAll(values map[string]any) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for name, value := range values {
+		v.values[name] = value
+	}
+}
+
+// Export sets the outputs of the scope to its parent as an object named after the test case,
+// so dependent test cases reference them like ${init.entity_id}. Outputs are looked up only in the scope,
+// so values of variables.yaml or of other test cases aren't shared as outputs.
+func (v *Variables) Export(testCase string, outputs []string) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	values := make(map[string]any, len(outputs))
+	for _, output := range outputs {
+		value, found := v.values[output]
+		if !found {
+			return models.NewErr(fmt.Sprintf("output %s of test case %s is not stored", output, testCase))
 		}
+
+		values[output] = value
+	}
+
+	if v.parent != nil {
+		v.parent.Set(testCase, values)
 	}
 
 	return nil
 }
 
-func (v Variables) Find(source string) (string, error) {
-	placeholder, found := strings.CutPrefix(source, "$")
+// ReplaceServicesMetadata substitutes metadata of all services, metadata of a service which can't be substituted
+// is left as is and the first such error is returned
+func (v *Variables) ReplaceServicesMetadata(services config.Services) error {
+	var result error
+	for key, service := range services {
+		md, err := v.ReplaceMap(service.Metadata)
+		if err != nil {
+			if result == nil {
+				result = errors.Wrapf(err, "error replacing metadata of service %s", key)
+			}
+
+			continue
+		}
+
+		service.Metadata = md
+		services[key] = service
+	}
+
+	return result
+}
+
+// Resolve returns value of the reference, like user.addresses[0].id, nested values are looked up
+// in stored objects and arrays
+func (v *Variables) Resolve(reference string) (any, error) {
+	name := reference
+	if i := strings.IndexAny(reference, ".["); i >= 0 {
+		name = reference[:i]
+	}
+
+	value, found := v.Get(name)
 	if !found {
+		return nil, errors.Wrap(ErrVariableNotFound, name)
+	}
+
+	for _, segment := range referenceSegmentRegExp.FindAllStringSubmatch(reference[len(name):], -1) {
+		switch current := value.(type) {
+		case map[string]any:
+			value, found = current[segment[1]]
+		case []any:
+			index, err := strconv.Atoi(segment[2])
+			found = err == nil && segment[2] != "" && index < len(current)
+			if found {
+				value = current[index]
+			}
+		default:
+			found = false
+		}
+
+		if !found {
+			return nil, errors.Wrap(ErrVariableNotFound, reference)
+		}
+	}
+
+	return value, nil
+}
+
+// formatVariable returns the value as a string, objects and arrays are encoded as json
+func formatVariable(value any) string {
+	switch t := value.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(t, 10)
+	case uint64:
+		return strconv.FormatUint(t, 10)
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprintf("%v", t)
+		}
+
+		return string(b)
+	}
+}
+
+// ReplaceInJson substitutes variables, references and expressions in strings of the parsed json,
+// so substituted values keep their types and can't break the json
+func (v *Variables) ReplaceInJson(source []byte) ([]byte, error) {
+	if !substitutionRegExp.Match(source) {
 		return source, nil
 	}
 
-	variable, found := v[placeholder]
-	if found {
-		return variable, nil
+	var parsed any
+	decoder := json.NewDecoder(bytes.NewReader(source))
+	decoder.UseNumber()
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, errors.Wrap(err, "error on parsing json")
+	}
+
+	replaced, err := walkStrings(parsed, v.substitute)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(replaced); err != nil {
+		return nil, errors.Wrap(err, "error on marshalling json")
 	}
 
-	return "", errors.Wrap(ErrVariableNotFound, variable)
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
-func (v Variables) ReplaceInJson(source []byte) ([]byte, error) {
-	matches := replacerRegExp.FindAll(source, -1)
-	for _, match := range matches {
-		variable, err := v.Find(string(match))
+// ReplaceMap returns a copy of the metadata with substituted values, the metadata of steps is shared
+// by instances of test cases with examples, so it's never changed in place
+func (v *Variables) ReplaceMap(md map[string]string) (map[string]string, error) {
+	if md == nil {
+		return nil, nil
+	}
+
+	result := make(map[string]string, len(md))
+	for key, value := range md {
+		replaced, err := v.substitute(value)
 		if err != nil {
 			return nil, err
 		}
 
-		source = bytes.ReplaceAll(source, match, []byte(variable))
+		result[key] = formatVariable(replaced)
 	}
 
-	return source, nil
+	return result, nil
 }
 
-func (v Variables) ReplaceMap(md map[string]string) error {
-	for key, value := range md {
-		replaced, err := v.Find(value)
+func (v *Variables) ReplaceResponse(response map[string]interface{}) (map[string]interface{}, error) {
+	replaced, err := walkStrings(response, v.substitute)
+	if err != nil {
+		return nil, err
+	}
+
+	return replaced.(map[string]interface{}), nil
+}
+
+// substitute replaces variables, references and expressions in the string. String which is a single
+// substitution is replaced with the value of its type, otherwise values are put into the string.
+// $$ is replaced with a literal dollar.
+func (v *Variables) substitute(source string) (any, error) {
+	matches := substitutionRegExp.FindAllStringSubmatchIndex(source, -1)
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(source) {
+		return v.resolveMatch(source, matches[0])
+	}
+
+	var builder strings.Builder
+	last := 0
+	for _, match := range matches {
+		value, err := v.resolveMatch(source, match)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		md[key] = replaced
+		builder.WriteString(source[last:match[0]])
+		builder.WriteString(formatVariable(value))
+		last = match[1]
 	}
+	builder.WriteString(source[last:])
 
-	return nil
+	return builder.String(), nil
+}
+
+// resolveMatch returns value of the match, which holds indexes of submatches of substitutionRegExp
+func (v *Variables) resolveMatch(source string, match []int) (any, error) {
+	switch {
+	case match[2] >= 0:
+		return evaluateExpression(source[match[2]:match[3]])
+	case match[4] >= 0:
+		reference := source[match[4]:match[5]]
+		if !referenceRegExp.MatchString(reference) {
+			return nil, models.NewErr(fmt.Sprintf("malformed reference ${%s}", reference))
+		}
+
+		return v.Resolve(reference)
+	case match[6] >= 0:
+		return v.Resolve(source[match[6]:match[7]])
+	default:
+		return "$", nil
+	}
 }
 
-func (v Variables) ReplaceResponse(response map[string]interface{}) (map[string]interface{}, error) {
-	for key, value := range response {
-		switch val := value.(type) {
-		case string:
-			replaced, err := v.Find(val)
-			if err != nil {
+// checkSubstitutions parses expressions and references of the string, so unknown functions and malformed
+// references are found before the run
+func checkSubstitutions(source string) (any, error) {
+	for _, match := range substitutionRegExp.FindAllStringSubmatchIndex(source, -1) {
+		if match[2] >= 0 {
+			if _, err := parseExpression(source[match[2]:match[3]]); err != nil {
 				return nil, err
 			}
+		}
+		if match[4] >= 0 && !referenceRegExp.MatchString(source[match[4]:match[5]]) {
+			return nil, models.NewErr(fmt.Sprintf("malformed reference %s", source[match[0]:match[1]]))
+		}
+	}
+
+	return source, nil
+}
 
-			response[key] = replaced
-		case []interface{}:
-		case map[string]interface{}:
-			replaced, err := v.ReplaceResponse(val)
-			if err != nil {
+// walkStrings replaces each string of the parsed json with the result of replace
+func walkStrings(value any, replace func(string) (any, error)) (any, error) {
+	var err error
+	switch t := value.(type) {
+	case string:
+		return replace(t)
+	case map[string]any:
+		for key, item := range t {
+			if t[key], err = walkStrings(item, replace); err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		for i, item := range t {
+			if t[i], err = walkStrings(item, replace); err != nil {
 				return nil, err
 			}
-
-			response[key] = replaced
 		}
-
 	}
 
-	return response, nil
+	return value, nil
 }
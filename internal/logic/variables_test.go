@@ -0,0 +1,149 @@
+package logic_test
+
+import (
+	"encoding/json"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/logic"
+	"github.com/res-am/grpc-fts/internal/models"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVariables_ReplaceInJson_Expressions(t *testing.T) {
+	t.Setenv("FTS_TOKEN", `se"cret`)
+	variables, err := logic.NewVariables(newRunContext(t, "--var", "name=john"))
+	assert.NoError(t, err)
+
+	replaced, err := variables.ReplaceInJson([]byte(`{
+		"id": "${{ uuid() }}",
+		"email": "$name-${{ randInt(1, 9) }}@example.com",
+		"token": "${{ env(\"FTS_TOKEN\") }}",
+		"auth": "${{ base64(\"user:\" + env(\"FTS_TOKEN\")) }}",
+		"expires": "${{ now() + \"1h\" | unix }}"
+	}`))
+	assert.NoError(t, err)
+
+	var request map[string]any
+	if assert.NoError(t, json.Unmarshal(replaced, &request)) {
+		assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), request["id"])
+		assert.Regexp(t, regexp.MustCompile(`^john-[1-9]@example\.com$`), request["email"])
+		assert.Equal(t, `se"cret`, request["token"])
+		assert.Equal(t, "dXNlcjpzZSJjcmV0", request["auth"])
+		assert.InDelta(t, time.Now().Add(time.Hour).Unix(), request["expires"], 5)
+	}
+
+	md := map[string]string{"x-request-id": "${{ randInt(5, 5) }}"}
+	replacedMD, err := variables.ReplaceMap(md)
+	assert.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(5), replacedMD["x-request-id"])
+	assert.Equal(t, "${{ randInt(5, 5) }}", md["x-request-id"])
+
+	_, err = variables.ReplaceInJson([]byte(`{"id": "${{ guid() }}"}`))
+	assert.ErrorContains(t, err, "unknown function guid")
+}
+
+func TestVariables_ReplaceInJson_References(t *testing.T) {
+	variables, err := logic.NewVariables(newRunContext(t))
+	assert.NoError(t, err)
+	variables.SetAll(map[string]any{
+		"user": map[string]any{
+			"id":        int64(9007199254740993),
+			"name":      `john "jd" doe`,
+			"active":    true,
+			"addresses": []any{map[string]any{"id": "a1"}},
+		},
+	})
+
+	replaced, err := variables.ReplaceInJson([]byte(`{
+		"id": "${user.id}",
+		"address": "${user.addresses[0].id}",
+		"greeting": "hi ${user.name}",
+		"active": "${user.active}",
+		"addresses": "${user.addresses}"
+	}`))
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"id": 9007199254740993,
+		"address": "a1",
+		"greeting": "hi john \"jd\" doe",
+		"active": true,
+		"addresses": [{"id": "a1"}]
+	}`, string(replaced))
+
+	_, err = variables.ReplaceInJson([]byte(`{"id": "${user.addresses[1].id}"}`))
+	assert.ErrorIs(t, err, logic.ErrVariableNotFound)
+	assert.ErrorContains(t, err, "user.addresses[1].id")
+}
+
+func TestVariables_ReplaceInJson_Typed(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "variables.yaml"), []byte(`
+limit: 10
+enabled: true
+title: say "hi"
+`), 0o600))
+	variables, err := logic.NewVariables(newRunContext(t, "--configs", dir))
+	assert.NoError(t, err)
+
+	replaced, err := variables.ReplaceInJson([]byte(`{
+		"limit": "${limit}",
+		"enabled": "${enabled}",
+		"title": "$title",
+		"summary": "${title} x${limit}",
+		"price": "$$5 for $$limit"
+	}`))
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"limit": 10,
+		"enabled": true,
+		"title": "say \"hi\"",
+		"summary": "say \"hi\" x10",
+		"price": "$5 for $limit"
+	}`, string(replaced))
+
+	_, err = variables.ReplaceInJson([]byte(`{"id": "$user_id"}`))
+	assert.ErrorIs(t, err, logic.ErrVariableNotFound)
+	assert.ErrorContains(t, err, "user_id")
+
+	_, err = variables.ReplaceInJson([]byte(`{"id": "${user..id}"}`))
+	assert.ErrorContains(t, err, "malformed reference ${user..id}")
+}
+
+func TestVariables_ReplaceServicesMetadata(t *testing.T) {
+	variables, err := logic.NewVariables(newRunContext(t, "--var", "token=secret"))
+	assert.NoError(t, err)
+	services := config.Services{
+		"users":  config.Service{Metadata: map[string]string{"authorization": "Bearer ${token}"}},
+		"orders": config.Service{Metadata: map[string]string{"authorization": "Bearer ${missing}"}},
+	}
+
+	err = variables.ReplaceServicesMetadata(services)
+
+	assert.ErrorIs(t, err, logic.ErrVariableNotFound)
+	assert.ErrorContains(t, err, "service orders")
+	assert.Equal(t, "Bearer secret", services["users"].Metadata["authorization"])
+	assert.Equal(t, "Bearer ${missing}", services["orders"].Metadata["authorization"])
+}
+
+func TestVariables_Export(t *testing.T) {
+	variables, err := logic.NewVariables(newRunContext(t, "--var", "token=secret"))
+	assert.NoError(t, err)
+	scope := variables.With(map[string]any{"role": "admin"})
+	scope.Set("entity_id", "e1")
+
+	assert.NoError(t, scope.Export("init", []string{"entity_id", "role"}))
+	value, err := variables.Resolve("init.entity_id")
+	assert.NoError(t, err)
+	assert.Equal(t, "e1", value)
+
+	err = scope.Export("init", []string{"token"})
+	assert.ErrorAs(t, err, &models.UserErr{})
+	assert.ErrorContains(t, err, "output token of test case init is not stored")
+}
@@ -0,0 +1,23 @@
+package models
+
+import "fmt"
+
+// Position is a location in a config file, zero position means the location is unknown
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+func (p Position) IsKnown() bool {
+	return p.File != ""
+}
+
+// String returns the position like file:line:column
+func (p Position) String() string {
+	if !p.IsKnown() {
+		return ""
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+type TestCaseStatus string
+
+const (
+	StatusPassed  TestCaseStatus = "passed"
+	StatusFailed  TestCaseStatus = "failed"
+	StatusSkipped TestCaseStatus = "skipped"
+	StatusErrored TestCaseStatus = "errored"
+)
+
+type Report struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	TestCases []TestCaseResult
+	// Setup and Teardown are results of global steps, nil if there are no such steps
+	Setup    *PhaseResult
+	Teardown *PhaseResult
+}
+
+type TestCaseResult struct {
+	Name     string
+	Status   TestCaseStatus
+	Duration time.Duration
+	Steps    []StepResult
+	// Message explains why test case was skipped or errored
+	Message string
+	// Teardown is reported separately, so its failure doesn't mask the result of the test case
+	Teardown *PhaseResult
+}
+
+// PhaseResult is a result of setup or teardown steps
+type PhaseResult struct {
+	Steps []StepResult
+	// Message explains why the phase failed, it's empty if all steps passed
+	Message string
+}
+
+func (r *PhaseResult) Failed() bool {
+	return r != nil && r.Message != ""
+}
+
+type StepResult struct {
+	// Name labels the step in reports, like "setup step 1"
+	Name     string
+	Service  string
+	Method   string
+	Duration time.Duration
+	Attempts int
+	Fails    []ValidationFail
+	// Position is a location of the step in the config file
+	Position Position
+}
+
+func NewReport() *Report {
+	return &Report{StartedAt: time.Now()}
+}
+
+func (r *Report) Add(result TestCaseResult) {
+	r.TestCases = append(r.TestCases, result)
+}
+
+func (r *Report) Finish() {
+	r.Duration = time.Since(r.StartedAt)
+}
+
+// TeardownFailures returns count of test cases which teardown failed
+func (r *Report) TeardownFailures() int {
+	count := 0
+	for _, testCase := range r.TestCases {
+		if testCase.Teardown.Failed() {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (r *Report) Count(status TestCaseStatus) int {
+	count := 0
+	for _, testCase := range r.TestCases {
+		if testCase.Status == status {
+			count++
+		}
+	}
+
+	return count
+}
@@ -5,6 +5,8 @@ type ValidationFail struct {
 	Function    string
 	Expectation interface{}
 	ActualValue string
+	// Position is a location of the expectation in the test case file
+	Position Position
 }
 
 func Fail(field, function string, expectation interface{}, actualValue string) ValidationFail {
@@ -22,11 +22,11 @@ type client struct {
 
 func NewClient(conn Connection, manager DescriptorsManager) Client {
 	return &client{conn: conn, dec: &protojson.UnmarshalOptions{
-		Resolver: nil,
+		Resolver: manager.Resolver(),
 	}, manager: manager}
 }
 
-func (c client) Invoke(fullName protoreflect.FullName, msg []byte, md metadata.MD) (*GRPCResponse, error) {
+func (c client) Invoke(fullName protoreflect.FullName, msg []byte, md metadata.MD, options InvokeOptions) (*GRPCResponse, error) {
 	if !fullName.IsValid() {
 		return nil, fmt.Errorf("invalid method name %s", string(fullName))
 	}
@@ -35,67 +35,96 @@ func (c client) Invoke(fullName protoreflect.FullName, msg []byte, md metadata.M
 
 	switch {
 	case descriptor.IsStreamingClient() && descriptor.IsStreamingServer():
-		stream, err := c.createStream(md, descriptor)
+		stream, cancel, err := c.createStream(md, descriptor)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create stream")
 		}
 
-		err = c.sendStreamRequests(msg, descriptor, stream)
+		err = c.sendStreamRequests(msg, descriptor, stream, options.SendDelay)
 		if err != nil {
+			cancel()
+
 			return nil, err
 		}
 
-		return NewGRPCStreamResponse(stream, descriptor.Output())
+		return NewGRPCStreamResponse(stream, cancel, descriptor.Output(), c.manager.Resolver())
 	case descriptor.IsStreamingClient():
-		stream, err := c.createStream(md, descriptor)
+		stream, cancel, err := c.createStream(md, descriptor)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create stream")
 		}
+		defer cancel()
 
-		err = c.sendStreamRequests(msg, descriptor, stream)
+		err = c.sendStreamRequests(msg, descriptor, stream, options.SendDelay)
 		if err != nil {
 			return nil, err
 		}
 
+		// the single response and the status are received after the sending side is closed
 		res := dynamicpb.NewMessage(descriptor.Output())
+		err = stream.RecvMsg(res)
+		header, _ := stream.Header()
 
-		return NewGRPCUnaryResponse(res, err)
+		return NewGRPCUnaryResponse(c.manager.Resolver(), res, header, stream.Trailer(), err)
 	case descriptor.IsStreamingServer():
-		stream, err := c.createStream(md, descriptor)
+		stream, cancel, err := c.createStream(md, descriptor)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create stream")
 		}
 
 		req, err := c.BuildRequest(descriptor.Input(), msg)
 		if err != nil {
+			cancel()
+
 			return nil, errors.Wrap(err, "failed to build request")
 		}
 		if err := stream.SendMsg(req); err != nil {
+			cancel()
+
 			return nil, errors.Wrapf(err, "failed to send a RPC to the server stream '%s'", descriptor.FullName())
 		}
 
-		return NewGRPCStreamResponse(stream, descriptor.Output())
+		return NewGRPCStreamResponse(stream, cancel, descriptor.Output(), c.manager.Resolver())
 	default:
 		req, err := c.BuildRequest(descriptor.Input(), msg)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to build request")
 		}
-		ctx, err := c.createContext(md)
+		ctx, cancel, err := c.createContext(md)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to create context")
 		}
+		defer cancel()
+
 		res := dynamicpb.NewMessage(descriptor.Output())
-		// todo: handle header and trailer
-		_, _, err = c.conn.Invoke(ctx, string(fullName), req, res)
+		header, trailer, err := c.conn.Invoke(ctx, string(fullName), req, res)
 
-		return NewGRPCUnaryResponse(res, err)
+		return NewGRPCUnaryResponse(c.manager.Resolver(), res, header, trailer, err)
 	}
 }
 
-func (c client) createStream(md metadata.MD, descriptor protoreflect.MethodDescriptor) (grpc.ClientStream, error) {
-	ctx, err := c.createContext(md)
+func (c client) Open(fullName protoreflect.FullName, md metadata.MD) (*GRPCResponse, error) {
+	if !fullName.IsValid() {
+		return nil, fmt.Errorf("invalid method name %s", string(fullName))
+	}
+
+	descriptor := c.manager.GetDescriptor(fullName)
+	if !descriptor.IsStreamingClient() || !descriptor.IsStreamingServer() {
+		return nil, fmt.Errorf("method %s is not bidirectional streaming", string(fullName))
+	}
+
+	stream, cancel, err := c.createStream(md, descriptor)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create context")
+		return nil, errors.Wrap(err, "failed to create stream")
+	}
+
+	return NewGRPCConversationResponse(stream, cancel, descriptor, c.manager.Resolver()), nil
+}
+
+func (c client) createStream(md metadata.MD, descriptor protoreflect.MethodDescriptor) (grpc.ClientStream, context.CancelFunc, error) {
+	ctx, cancel, err := c.createContext(md)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to create context")
 	}
 	streamDesc := &grpc.StreamDesc{
 		StreamName:    string(descriptor.Name()),
@@ -104,26 +133,31 @@ func (c client) createStream(md metadata.MD, descriptor protoreflect.MethodDescr
 	}
 	stream, err := c.conn.Stream(ctx, string(descriptor.FullName()), streamDesc)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create stream")
+		cancel()
+
+		return nil, nil, errors.Wrap(err, "failed to create stream")
 	}
-	return stream, nil
+
+	return stream, cancel, nil
 }
 
-func (c client) createContext(md metadata.MD) (context.Context, error) {
+func (c client) createContext(md metadata.MD) (context.Context, context.CancelFunc, error) {
 	ctx := metadata.NewOutgoingContext(context.Background(), md)
 	values := md.Get("timeout")
 	if len(values) == 0 {
-		return ctx, nil
+		ctx, cancel := context.WithCancel(ctx)
+
+		return ctx, cancel, nil
 	}
 
 	timeout, err := time.ParseDuration(values[len(values)-1])
 	if err != nil {
-		return nil, errors.Wrapf(err, "malformed grpc-timeout header")
+		return nil, nil, errors.Wrapf(err, "malformed grpc-timeout header")
 	}
 
-	ctx, _ = context.WithTimeout(ctx, timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 
-	return ctx, nil
+	return ctx, cancel, nil
 }
 
 func (c client) BuildRequest(desc protoreflect.MessageDescriptor, msg []byte) (*dynamicpb.Message, error) {
@@ -139,28 +173,36 @@ func (c client) BuildRequest(desc protoreflect.MessageDescriptor, msg []byte) (*
 	return req, nil
 }
 
-func (c client) sendStreamRequests(msg []byte, descriptor protoreflect.MethodDescriptor, stream grpc.ClientStream) error {
+// sendStreamRequests sends messages of the request array and closes the sending side of the stream.
+// Sending is stopped if the server has finished the stream, its status is received by the caller.
+func (c client) sendStreamRequests(
+	msg []byte, descriptor protoreflect.MethodDescriptor, stream grpc.ClientStream, delay time.Duration,
+) error {
 	// parse array of requests from yaml (underlying json)
-	requests := make([]interface{}, 0)
-	err := json.Unmarshal(msg, &requests)
-	if err != nil {
-		return errors.Wrap(err, "failed to unmarshal stream requests")
-	}
-	for _, anyRequest := range requests {
-		jsonRequest, err := json.Marshal(anyRequest)
-		if err != nil {
-			return errors.Wrap(err, "failed to marshal stream request")
+	requests := make([]json.RawMessage, 0)
+	if len(msg) > 0 {
+		if err := json.Unmarshal(msg, &requests); err != nil {
+			return errors.Wrap(err, "failed to unmarshal stream requests")
 		}
+	}
+	for i, jsonRequest := range requests {
 		req, err := c.BuildRequest(descriptor.Input(), jsonRequest)
 		if err != nil {
 			return errors.Wrap(err, "failed to build request")
 		}
-		if err := stream.SendMsg(req); err != nil {
+		if i > 0 && delay > 0 {
+			time.Sleep(delay)
+		}
+		err = stream.SendMsg(req)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
 			return errors.Wrapf(err, "failed to send a RPC to the server stream '%s'", descriptor.FullName())
 		}
 	}
 
-	err = stream.CloseSend()
+	err := stream.CloseSend()
 	if err != nil {
 		return errors.Wrap(err, "failed to close the stream")
 	}
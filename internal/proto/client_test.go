@@ -13,7 +13,9 @@ import (
 	"google.golang.org/grpc/status"
 	"io"
 	"net"
+	"strings"
 	"testing"
+	"time"
 )
 
 type TestService struct {
@@ -25,14 +27,19 @@ func (t TestService) UnaryMethod(ctx context.Context, request *grpc_fts.TestMess
 }
 
 func (t TestService) ClientStreamMethod(stream grpc.ClientStreamingServer[grpc_fts.TestMessage, grpc_fts.TestMessage]) error {
+	received := make([]string, 0)
 	for {
-		_, err := stream.Recv()
+		message, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
-			return stream.SendAndClose(&grpc_fts.TestMessage{Data: "ok"})
+			return stream.SendAndClose(&grpc_fts.TestMessage{Data: strings.Join(received, ",")})
 		}
 		if err != nil {
 			return status.Errorf(codes.Internal, "error on receive message")
 		}
+		if message.Data == "fail" {
+			return status.Errorf(codes.InvalidArgument, "received %d messages", len(received))
+		}
+		received = append(received, message.Data)
 	}
 }
 func (t TestService) ServerStreamMethod(req *grpc_fts.TestMessage, stream grpc.ServerStreamingServer[grpc_fts.TestMessage]) error {
@@ -112,19 +119,28 @@ func TestClient_Invoke(t *testing.T) {
 	assert.NoError(t, err)
 
 	client := proto.NewClient(conn, descriptorManager)
-	res, err := client.Invoke(serviceDesc.Methods().ByName("UnaryMethod").FullName(), []byte(`{"data": "test"}`), nil)
+	res, err := client.Invoke(serviceDesc.Methods().ByName("UnaryMethod").FullName(), []byte(`{"data": "test"}`), nil, proto.InvokeOptions{})
 	assert.NoError(t, err, "error on invoke")
 	assert.Equal(t, codes.OK, res.Status.Code())
 
-	res, err = client.Invoke(serviceDesc.Methods().ByName("ClientStreamMethod").FullName(), []byte(`[{"data": "test"}, {"data": "test2"}]`), nil)
+	started := time.Now()
+	options := proto.InvokeOptions{SendDelay: 20 * time.Millisecond}
+	res, err = client.Invoke(serviceDesc.Methods().ByName("ClientStreamMethod").FullName(), []byte(`[{"data": "test"}, {"data": "test2"}]`), nil, options)
 	assert.NoError(t, err, "error on invoke")
 	assert.Equal(t, codes.OK, res.Status.Code())
+	assert.Equal(t, "test,test2", res.Response["data"])
+	assert.GreaterOrEqual(t, time.Since(started), 20*time.Millisecond)
+
+	res, err = client.Invoke(serviceDesc.Methods().ByName("ClientStreamMethod").FullName(), []byte(`[{"data": "test"}, {"data": "fail"}]`), nil, proto.InvokeOptions{})
+	assert.NoError(t, err, "error on invoke")
+	assert.Equal(t, codes.InvalidArgument, res.Status.Code())
+	assert.Equal(t, "received 1 messages", res.Status.Message())
 
-	res, err = client.Invoke(serviceDesc.Methods().ByName("ServerStreamMethod").FullName(), []byte(`{"data": "test2"}`), nil)
+	res, err = client.Invoke(serviceDesc.Methods().ByName("ServerStreamMethod").FullName(), []byte(`{"data": "test2"}`), nil, proto.InvokeOptions{})
 	assert.NoError(t, err, "error on invoke")
 	assert.Equal(t, codes.OK, res.Status.Code())
 
-	res, err = client.Invoke(serviceDesc.Methods().ByName("BidiStreamMethod").FullName(), []byte(`[{"data": "test"}, {"data": "test2"}]`), nil)
+	res, err = client.Invoke(serviceDesc.Methods().ByName("BidiStreamMethod").FullName(), []byte(`[{"data": "test"}, {"data": "test2"}]`), nil, proto.InvokeOptions{})
 	assert.NoError(t, err, "error on invoke")
 	assert.Equal(t, codes.OK, res.Status.Code())
 }
@@ -98,6 +98,10 @@ func (c grpcConnection) Stream(ctx context.Context, fullName string, streamDesc
 	return stream, nil
 }
 
+func (c grpcConnection) Close() error {
+	return c.conn.Close()
+}
+
 func wakeUpClientConn(conn *grpc.ClientConn) {
 	if conn.GetState() == connectivity.TransientFailure {
 		conn.ResetConnectBackoff()
@@ -0,0 +1,129 @@
+package proto
+
+import (
+	"fmt"
+	"github.com/bufbuild/protocompile/linker"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/models"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// loadDescriptorSets builds registry from binary FileDescriptorSets (protoc --descriptor_set_out) and Buf images.
+// Buf image is wire compatible with FileDescriptorSet, so both are read the same way,
+// images in JSON format are detected by .json extension.
+// Compiled proto sources are checked for conflicts with loaded files, compiled can be nil.
+func loadDescriptorSets(paths []string, compiled linker.Files) (*protoregistry.Files, error) {
+	builder := newFilesBuilder(nil)
+	origins := make(map[string]string)
+	for _, path := range paths {
+		set, err := readDescriptorSet(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range set.GetFile() {
+			if builder.add(file) {
+				origins[file.GetName()] = path
+
+				continue
+			}
+			if !protobuf.Equal(builder.protos[file.GetName()], file) {
+				return nil, models.NewErr(fmt.Sprintf(
+					"file %s is different in descriptor sets %s and %s", file.GetName(), origins[file.GetName()], path,
+				))
+			}
+		}
+	}
+
+	for path := range builder.protos {
+		if err := builder.register(path); err != nil {
+			return nil, errors.Wrapf(err, "error loading descriptor set %s", origins[path])
+		}
+	}
+
+	if compiled != nil {
+		if err := checkConflicts(builder.files, origins, compiled.AsResolver()); err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.files, nil
+}
+
+func readDescriptorSet(path string) (*descriptorpb.FileDescriptorSet, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, models.NewErr(fmt.Sprintf("descriptor set %s not found", path))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading descriptor set %s", path)
+	}
+
+	set := new(descriptorpb.FileDescriptorSet)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(content, set)
+	} else {
+		err = protobuf.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(content, set)
+	}
+	if err != nil {
+		return nil, models.NewErr(fmt.Sprintf("error parsing descriptor set %s: %s", path, err.Error()))
+	}
+
+	return set, nil
+}
+
+// checkConflicts reports declarations which exist both in descriptor sets and in compiled proto sources
+// under different files. The same file in both places is not a conflict, like well-known types.
+func checkConflicts(files *protoregistry.Files, origins map[string]string, compiled linker.Resolver) error {
+	conflicts := make([]string, 0)
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		if _, err := compiled.FindFileByPath(fd.Path()); err == nil {
+			return true
+		}
+
+		for _, name := range topLevelDeclarations(fd) {
+			d, err := compiled.FindDescriptorByName(name)
+			if err != nil {
+				continue
+			}
+
+			conflicts = append(conflicts, fmt.Sprintf(
+				"%s is declared in proto source %s and in %s of descriptor set %s",
+				name, d.ParentFile().Path(), fd.Path(), origins[fd.Path()],
+			))
+		}
+
+		return true
+	})
+
+	if len(conflicts) > 0 {
+		return models.NewErr("descriptor sets conflict with proto sources:\n" + strings.Join(conflicts, "\n"))
+	}
+
+	return nil
+}
+
+func topLevelDeclarations(fd protoreflect.FileDescriptor) []protoreflect.FullName {
+	names := make([]protoreflect.FullName, 0)
+	for i := 0; i < fd.Messages().Len(); i++ {
+		names = append(names, fd.Messages().Get(i).FullName())
+	}
+	for i := 0; i < fd.Enums().Len(); i++ {
+		names = append(names, fd.Enums().Get(i).FullName())
+	}
+	for i := 0; i < fd.Services().Len(); i++ {
+		names = append(names, fd.Services().Get(i).FullName())
+	}
+	for i := 0; i < fd.Extensions().Len(); i++ {
+		names = append(names, fd.Extensions().Get(i).FullName())
+	}
+
+	return names
+}
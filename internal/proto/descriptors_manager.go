@@ -13,15 +13,94 @@ import (
 	"strings"
 )
 
+const (
+	DescriptorsLocal      = "local"
+	DescriptorsReflection = "reflection"
+)
+
 type descriptorsManager struct {
 	descriptors map[protoreflect.FullName]protoreflect.MethodDescriptor
+	resolver    Resolver
+	sources     *sourcesProvider
+}
+
+// descriptorSource is a place where descriptors can be found, compiled proto files or server reflection
+type descriptorSource interface {
+	FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error)
+}
+
+// method is a method of the configured service, which descriptor is resolved on start
+type method struct {
+	serviceName string
+	service     config.Service
+	name        string
 }
 
 func NewDescriptorsManager(cfg *config.Global, testCases config.TestCases) (DescriptorsManager, error) {
+	steps := append(append([]config.Step{}, cfg.Setup...), cfg.Teardown...)
+	for _, testCase := range testCases {
+		steps = append(steps, testCase.AllSteps()...)
+	}
+
+	methods := make([]method, 0, len(steps))
+	for _, step := range steps {
+		methods = append(methods, method{serviceName: step.ServiceName, service: step.Service, name: step.Method})
+	}
+
+	return newDescriptorsManager(cfg, methods)
+}
+
+// NewStubsDescriptorsManager resolves descriptors of methods served by the mock server
+func NewStubsDescriptorsManager(cfg *config.Global, stubs config.Stubs) (DescriptorsManager, error) {
+	methods := make([]method, 0, len(stubs))
+	for _, stub := range stubs {
+		methods = append(methods, method{serviceName: stub.ServiceName, service: stub.Service, name: stub.Method})
+	}
+
+	return newDescriptorsManager(cfg, methods)
+}
+
+func newDescriptorsManager(cfg *config.Global, methods []method) (DescriptorsManager, error) {
 	manager := &descriptorsManager{
 		descriptors: make(map[protoreflect.FullName]protoreflect.MethodDescriptor),
 	}
 
+	local := make([]descriptorSource, 0, 2)
+	var compiled linker.Files
+	if cfg.ProtoRoot != "" || len(cfg.ProtoSources) > 0 {
+		var err error
+		compiled, err = compileSources(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		local = append(local, compiled.AsResolver())
+	}
+	if len(cfg.ProtoDescriptorSets) > 0 {
+		sets, err := loadDescriptorSets(cfg.ProtoDescriptorSets, compiled)
+		if err != nil {
+			return nil, err
+		}
+
+		local = append(local, sets)
+	}
+
+	sources, err := newSourcesProvider(cfg, local)
+	if err != nil {
+		return nil, err
+	}
+
+	manager.sources = sources
+	err = updateDescriptors(manager, methods, sources)
+	if err != nil {
+		return nil, errors.Wrap(err, "error updating descriptors")
+	}
+	manager.resolver = newTypesResolver(local, sources.reflectionSources())
+
+	return manager, nil
+}
+
+func compileSources(cfg *config.Global) (linker.Files, error) {
 	files, err := collectFiles(cfg.ProtoSources, cfg.ProtoRoot)
 	if err != nil {
 		return nil, errors.Wrap(err, "error collecting proto sources")
@@ -37,12 +116,7 @@ func NewDescriptorsManager(cfg *config.Global, testCases config.TestCases) (Desc
 		return nil, errors.Wrap(err, "error compiling proto sources")
 	}
 
-	err = updateDescriptors(manager, testCases, compiled)
-	if err != nil {
-		return nil, errors.Wrap(err, "error updating descriptors")
-	}
-
-	return manager, nil
+	return compiled, nil
 }
 
 func collectFiles(sources []string, root string) ([]string, error) {
@@ -97,36 +171,65 @@ func fileList(root string) ([]string, error) {
 	return files, nil
 }
 
-func updateDescriptors(manager *descriptorsManager, testCases config.TestCases, compiled linker.Files) error {
-	for _, testCase := range testCases {
-		for _, step := range testCase.Steps {
-			fullName := step.Service.Service + "." + step.Method
-			fullNameReflect := protoreflect.FullName(fullName)
-			if _, ok := manager.descriptors[fullNameReflect]; ok {
-				continue
-			}
+func updateDescriptors(manager *descriptorsManager, methods []method, sources *sourcesProvider) error {
+	for _, m := range methods {
+		fullName := m.service.Service + "." + m.name
+		fullNameReflect := protoreflect.FullName(fullName)
+		if _, ok := manager.descriptors[fullNameReflect]; ok {
+			continue
+		}
+		if !fullNameReflect.IsValid() {
+			return fmt.Errorf("method %s is not valid", fullName)
+		}
 
-			var d protoreflect.Descriptor
-			for _, fd := range compiled {
-				if !fullNameReflect.IsValid() {
-					return fmt.Errorf("method %s is not valid", fullName)
-				}
+		methodSources, err := sources.get(m.serviceName, m.service)
+		if err != nil {
+			return err
+		}
 
-				if d = fd.FindDescriptorByName(fullNameReflect); d != nil {
-					break
-				}
-			}
-			if d == nil {
-				return fmt.Errorf("method %s not found in sources", fullName)
-			}
+		d, err := findDescriptor(fullNameReflect, methodSources)
+		if err != nil {
+			return err
+		}
 
-			manager.descriptors[fullNameReflect] = d.(protoreflect.MethodDescriptor)
+		descriptor, ok := d.(protoreflect.MethodDescriptor)
+		if !ok {
+			return fmt.Errorf("%s is not a method", fullName)
 		}
+
+		manager.descriptors[fullNameReflect] = descriptor
 	}
 
 	return nil
 }
 
+// findDescriptor looks for the descriptor in sources by order, the first found wins
+func findDescriptor(name protoreflect.FullName, sources []descriptorSource) (protoreflect.Descriptor, error) {
+	messages := make([]string, 0, len(sources))
+	for _, source := range sources {
+		d, err := source.FindDescriptorByName(name)
+		if err == nil {
+			return d, nil
+		}
+
+		messages = append(messages, err.Error())
+	}
+
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("method %s not found in sources", name)
+	}
+
+	return nil, fmt.Errorf("method %s not found in sources: %s", name, strings.Join(messages, "; "))
+}
+
 func (d *descriptorsManager) GetDescriptor(name protoreflect.FullName) protoreflect.MethodDescriptor {
 	return d.descriptors[name]
 }
+
+func (d *descriptorsManager) Resolver() Resolver {
+	return d.resolver
+}
+
+func (d *descriptorsManager) Close() error {
+	return d.sources.close()
+}
@@ -0,0 +1,282 @@
+package proto_test
+
+import (
+	"context"
+	"github.com/bufbuild/protocompile"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/proto"
+	grpc_fts "github.com/res-am/grpc-fts/internal/proto/test_data"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// compiledTestFiles returns test.proto compiled from the source, because the generated descriptor
+// is registered under another package and can't be served by reflection
+func compiledTestFiles(t *testing.T) *protoregistry.Files {
+	c := &protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			ImportPaths: []string{"test_data"},
+		}),
+	}
+	compiled, err := c.Compile(context.Background(), "test.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := new(protoregistry.Files)
+	if err := files.RegisterFile(compiled[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+// requireAuthorization rejects streams without authorization metadata, like servers which protect reflection
+func requireAuthorization(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	md, _ := metadata.FromIncomingContext(ss.Context())
+	if len(md.Get("authorization")) == 0 {
+		return status.Error(codes.Unauthenticated, "authorization is required")
+	}
+
+	return handler(srv, ss)
+}
+
+func TestNewDescriptorsManager_Reflection(t *testing.T) {
+	server := grpc.NewServer(grpc.StreamInterceptor(requireAuthorization))
+	server.RegisterService(&grpc_fts.TestService_ServiceDesc, &TestService{})
+	reflectionpb.RegisterServerReflectionServer(server, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           server,
+		DescriptorResolver: compiledTestFiles(t),
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer server.Stop()
+	go func() {
+		_ = server.Serve(ln)
+	}()
+
+	service := config.Service{
+		Service: "test.TestService", Address: ln.Addr().String(), Descriptors: "reflection",
+		Metadata: map[string]string{"authorization": "Bearer token"},
+	}
+	testCases := config.TestCases{
+		{
+			Steps: []config.Step{
+				{ServiceName: "test", Method: "UnaryMethod", Service: service},
+				{ServiceName: "test", Method: "BidiStreamMethod", Service: service},
+			},
+		},
+	}
+
+	manager, err := proto.NewDescriptorsManager(&config.Global{}, testCases)
+	assert.NoError(t, err)
+
+	descriptor := manager.GetDescriptor("test.TestService.BidiStreamMethod")
+	assert.NotNil(t, descriptor)
+	assert.True(t, descriptor.IsStreamingClient())
+	assert.Equal(t, protoreflect.FullName("test.TestMessage"), descriptor.Input().FullName())
+	assert.NoError(t, manager.Close())
+}
+
+// extraFiles returns test.proto and extra.proto, which is not imported by test.proto,
+// so its types are fetched only when they are resolved
+func extraFiles(t *testing.T) *protoregistry.Files {
+	c := &protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(map[string]string{
+				"extra.proto": "syntax = \"proto3\";\npackage extra;\nmessage Extra {\n  string data = 1;\n}\n",
+			}),
+		}),
+	}
+	compiled, err := c.Compile(context.Background(), "extra.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := compiledTestFiles(t)
+	if err := files.RegisterFile(compiled[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	return files
+}
+
+func TestNewDescriptorsManager_ReflectionParallel(t *testing.T) {
+	server := grpc.NewServer()
+	server.RegisterService(&grpc_fts.TestService_ServiceDesc, &TestService{})
+	reflectionpb.RegisterServerReflectionServer(server, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           server,
+		DescriptorResolver: extraFiles(t),
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer server.Stop()
+	go func() {
+		_ = server.Serve(ln)
+	}()
+
+	service := config.Service{Service: "test.TestService", Address: ln.Addr().String(), Descriptors: "reflection"}
+	testCases := config.TestCases{
+		{Steps: []config.Step{{ServiceName: "test", Method: "UnaryMethod", Service: service}}},
+	}
+
+	manager, err := proto.NewDescriptorsManager(&config.Global{}, testCases)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, manager.Close())
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			message, err := manager.Resolver().FindMessageByName("extra.Extra")
+			if assert.NoError(t, err) {
+				assert.Equal(t, protoreflect.FullName("extra.Extra"), message.Descriptor().FullName())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestNewDescriptorsManager_ReflectionResolver(t *testing.T) {
+	var requests atomic.Int32
+	countRequests := func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		requests.Add(1)
+
+		return handler(srv, ss)
+	}
+	server := grpc.NewServer(grpc.StreamInterceptor(countRequests))
+	server.RegisterService(&grpc_fts.TestService_ServiceDesc, &TestService{})
+	reflectionpb.RegisterServerReflectionServer(server, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           server,
+		DescriptorResolver: extraFiles(t),
+	}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer server.Stop()
+	go func() {
+		_ = server.Serve(ln)
+	}()
+
+	service := config.Service{Service: "test.TestService", Address: ln.Addr().String(), Descriptors: "reflection"}
+	testCases := config.TestCases{
+		{Steps: []config.Step{{ServiceName: "test", Method: "UnaryMethod", Service: service}}},
+	}
+
+	manager, err := proto.NewDescriptorsManager(&config.Global{}, testCases)
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, manager.Close())
+	}()
+	requests.Store(0)
+
+	_, err = manager.Resolver().FindMessageByName("google.rpc.ErrorInfo")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), requests.Load())
+
+	for i := 0; i < 2; i++ {
+		_, err = manager.Resolver().FindMessageByName("extra.Unknown")
+		assert.ErrorIs(t, err, protoregistry.NotFound)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	_, err = manager.Resolver().FindMessageByName("extra.Extra")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestNewDescriptorsManager_ReflectionNotFound(t *testing.T) {
+	server := grpc.NewServer()
+	reflection.Register(server)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer server.Stop()
+	go func() {
+		_ = server.Serve(ln)
+	}()
+
+	testCases := config.TestCases{
+		{
+			Steps: []config.Step{{
+				ServiceName: "test",
+				Method:      "UnknownMethod",
+				Service:     config.Service{Service: "test.UnknownService", Address: ln.Addr().String()},
+			}},
+		},
+	}
+
+	_, err = proto.NewDescriptorsManager(&config.Global{Descriptors: "reflection"}, testCases)
+	assert.ErrorContains(t, err, "method test.UnknownService.UnknownMethod not found in sources")
+}
+
+func writeDescriptorSet(t *testing.T, files ...*descriptorpb.FileDescriptorProto) string {
+	content, err := protobuf.Marshal(&descriptorpb.FileDescriptorSet{File: files})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "descriptor_set.binpb")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func testFileProto(t *testing.T) *descriptorpb.FileDescriptorProto {
+	fd, err := compiledTestFiles(t).FindFileByPath("test.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return protodesc.ToFileDescriptorProto(fd)
+}
+
+func TestNewDescriptorsManager_DescriptorSet(t *testing.T) {
+	cfg := &config.Global{ProtoDescriptorSets: []string{writeDescriptorSet(t, testFileProto(t))}}
+	testCases := config.TestCases{
+		{
+			Steps: []config.Step{{Method: "ServerStreamMethod", Service: config.Service{Service: "test.TestService"}}},
+		},
+	}
+
+	manager, err := proto.NewDescriptorsManager(cfg, testCases)
+	assert.NoError(t, err)
+	assert.True(t, manager.GetDescriptor("test.TestService.ServerStreamMethod").IsStreamingServer())
+}
+
+func TestNewDescriptorsManager_DescriptorSetConflict(t *testing.T) {
+	file := testFileProto(t)
+	file.Name = protobuf.String("moved/test.proto")
+	cfg := &config.Global{
+		ProtoSources:        []string{"test.proto"},
+		ProtoRoot:           "test_data",
+		ProtoDescriptorSets: []string{writeDescriptorSet(t, file)},
+	}
+
+	_, err := proto.NewDescriptorsManager(cfg, config.TestCases{})
+	assert.ErrorContains(t, err, "test.TestMessage is declared in proto source test.proto and in moved/test.proto")
+}
@@ -0,0 +1,74 @@
+package proto
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// filesBuilder builds registry of file descriptors from raw file descriptor protos.
+// Dependencies are resolved transitively, well-known types which are not provided are taken
+// from the global registry.
+type filesBuilder struct {
+	files  *protoregistry.Files
+	protos map[string]*descriptorpb.FileDescriptorProto
+	// fetch is called to load file which is not provided yet, optional
+	fetch func(path string) error
+}
+
+func newFilesBuilder(fetch func(path string) error) *filesBuilder {
+	return &filesBuilder{
+		files:  new(protoregistry.Files),
+		protos: make(map[string]*descriptorpb.FileDescriptorProto),
+		fetch:  fetch,
+	}
+}
+
+// add makes file available for registration, the first added file with the same path wins
+func (b *filesBuilder) add(file *descriptorpb.FileDescriptorProto) bool {
+	if _, ok := b.protos[file.GetName()]; ok {
+		return false
+	}
+
+	b.protos[file.GetName()] = file
+
+	return true
+}
+
+func (b *filesBuilder) register(path string) error {
+	if _, err := b.files.FindFileByPath(path); err == nil {
+		return nil
+	}
+
+	file, ok := b.protos[path]
+	if !ok {
+		if fd, err := protoregistry.GlobalFiles.FindFileByPath(path); err == nil {
+			return b.files.RegisterFile(fd)
+		}
+		if b.fetch == nil {
+			return fmt.Errorf("file %s not found", path)
+		}
+
+		if err := b.fetch(path); err != nil {
+			return err
+		}
+		if file, ok = b.protos[path]; !ok {
+			return fmt.Errorf("file %s not found", path)
+		}
+	}
+
+	for _, dependency := range file.GetDependency() {
+		if err := b.register(dependency); err != nil {
+			return errors.Wrapf(err, "dependency of %s", path)
+		}
+	}
+
+	fd, err := protodesc.NewFile(file, b.files)
+	if err != nil {
+		return errors.Wrapf(err, "error building file descriptor %s", path)
+	}
+
+	return b.files.RegisterFile(fd)
+}
@@ -1,26 +1,46 @@
 package proto
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/dynamicpb"
+	"time"
 )
 
+// ErrReceiveTimeout is returned when the stream message isn't received in time
+var ErrReceiveTimeout = errors.New("stream message is not received in time")
+
 type GRPCResponse struct {
-	Response           map[string]interface{}
-	Status             *status.Status
+	Response map[string]interface{}
+	Status   *status.Status
+	// StatusDetails are decoded details of the status, each one has @type key with type url
+	StatusDetails []interface{}
+	// Header is received with the first message of the stream
+	Header metadata.MD
+	// Trailer is received when the stream is finished
+	Trailer            metadata.MD
 	Stream             grpc.ClientStream
 	IsStream           bool
 	responseDescriptor protoreflect.MessageDescriptor
+	resolver           Resolver
+	cancel             context.CancelFunc
+	// requestDescriptor is set for conversations, which send messages one by one
+	requestDescriptor protoreflect.MessageDescriptor
 }
 
-func NewGRPCUnaryResponse(response *dynamicpb.Message, err error) (*GRPCResponse, error) {
-	result := &GRPCResponse{IsStream: false}
+func NewGRPCUnaryResponse(resolver Resolver, response *dynamicpb.Message, header, trailer metadata.MD, err error) (*GRPCResponse, error) {
+	result := &GRPCResponse{IsStream: false, Header: header, Trailer: trailer, resolver: resolver}
+	if response != nil {
+		result.responseDescriptor = response.Descriptor()
+	}
 
 	err = result.UnmarshalResponse(response, err)
 	if err != nil {
@@ -30,15 +50,90 @@ func NewGRPCUnaryResponse(response *dynamicpb.Message, err error) (*GRPCResponse
 	return result, nil
 }
 
-func NewGRPCStreamResponse(stream grpc.ClientStream, descriptor protoreflect.MessageDescriptor) (*GRPCResponse, error) {
-	response := &GRPCResponse{IsStream: true, Stream: stream, responseDescriptor: descriptor}
+func NewGRPCStreamResponse(
+	stream grpc.ClientStream, cancel context.CancelFunc, descriptor protoreflect.MessageDescriptor, resolver Resolver,
+) (*GRPCResponse, error) {
+	response := &GRPCResponse{IsStream: true, Stream: stream, responseDescriptor: descriptor, cancel: cancel, resolver: resolver}
 
 	return response, nil
 }
 
+// NewGRPCConversationResponse returns the opened bidirectional stream, messages are sent to it with StreamSend
+func NewGRPCConversationResponse(
+	stream grpc.ClientStream, cancel context.CancelFunc, descriptor protoreflect.MethodDescriptor, resolver Resolver,
+) *GRPCResponse {
+	return &GRPCResponse{
+		IsStream: true, Stream: stream, responseDescriptor: descriptor.Output(), requestDescriptor: descriptor.Input(),
+		cancel: cancel, resolver: resolver,
+	}
+}
+
+// Descriptor returns descriptor of the response message
+func (r *GRPCResponse) Descriptor() protoreflect.MessageDescriptor {
+	return r.responseDescriptor
+}
+
+// Close releases the stream context, it's safe to call it for unary responses as well
+func (r *GRPCResponse) Close() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// RequestDescriptor returns descriptor of messages sent to the conversation
+func (r *GRPCResponse) RequestDescriptor() protoreflect.MessageDescriptor {
+	return r.requestDescriptor
+}
+
+func (r *GRPCResponse) StreamSend(message proto.Message) error {
+	if err := r.Stream.SendMsg(message); err != nil {
+		return errors.Wrap(err, "failed to send a message to the stream")
+	}
+
+	return nil
+}
+
+// CloseSend closes the sending side of the stream, the server receives io.EOF
+func (r *GRPCResponse) CloseSend() error {
+	if err := r.Stream.CloseSend(); err != nil {
+		return errors.Wrap(err, "failed to close the stream")
+	}
+
+	return nil
+}
+
+// StreamReceiveWithin receives the next message of the stream, the stream is cancelled if the message
+// isn't received in time
+func (r *GRPCResponse) StreamReceiveWithin(timeout time.Duration) error {
+	received := make(chan error, 1)
+	go func() {
+		received <- r.StreamReceive()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-received:
+		return err
+	case <-timer.C:
+		r.Close()
+		<-received
+
+		return ErrReceiveTimeout
+	}
+}
+
 func (r *GRPCResponse) StreamReceive() error {
 	response := dynamicpb.NewMessage(r.responseDescriptor)
 	err := r.Stream.RecvMsg(response)
+	if r.Header == nil {
+		// header is already received at this point, so it doesn't block
+		r.Header, _ = r.Stream.Header()
+	}
+	if err != nil {
+		r.Trailer = r.Stream.Trailer()
+	}
 
 	err = r.UnmarshalResponse(response, err)
 	if err != nil {
@@ -54,8 +149,9 @@ func (r *GRPCResponse) UnmarshalResponse(response *dynamicpb.Message, err error)
 	if !ok && err != nil {
 		return errors.Wrap(err, "failed parsing status")
 	}
+	r.StatusDetails = r.decodeDetails()
 
-	b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(proto.Message(response))
+	b, err := r.marshalOptions().Marshal(proto.Message(response))
 	if err != nil {
 		return errors.Wrap(err, "failed to marshal response from proto to json")
 	}
@@ -67,3 +163,36 @@ func (r *GRPCResponse) UnmarshalResponse(response *dynamicpb.Message, err error)
 
 	return nil
 }
+
+func (r *GRPCResponse) marshalOptions() protojson.MarshalOptions {
+	options := protojson.MarshalOptions{EmitUnpopulated: true}
+	if r.resolver != nil {
+		options.Resolver = r.resolver
+	}
+
+	return options
+}
+
+// decodeDetails converts status details to json structures, details of unknown types are kept
+// as base64 encoded value
+func (r *GRPCResponse) decodeDetails() []interface{} {
+	details := r.Status.Proto().GetDetails()
+	result := make([]interface{}, 0, len(details))
+	for _, detail := range details {
+		var decoded map[string]interface{}
+		b, err := r.marshalOptions().Marshal(detail)
+		if err == nil {
+			err = json.Unmarshal(b, &decoded)
+		}
+		if err != nil {
+			decoded = map[string]interface{}{
+				"@type": detail.GetTypeUrl(),
+				"value": base64.StdEncoding.EncodeToString(detail.GetValue()),
+			}
+		}
+
+		result = append(result, decoded)
+	}
+
+	return result
+}
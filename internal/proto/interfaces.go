@@ -5,11 +5,22 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/dynamicpb"
+	"time"
 )
 
 type DescriptorsManager interface {
 	GetDescriptor(name protoreflect.FullName) protoreflect.MethodDescriptor
+	// Resolver resolves message types of Any fields from all descriptor sources
+	Resolver() Resolver
+	// Close closes connections used to resolve descriptors, like connections of server reflection
+	Close() error
+}
+
+type Resolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
 }
 
 type ClientsManager interface {
@@ -17,11 +28,20 @@ type ClientsManager interface {
 }
 
 type Client interface {
-	Invoke(fullName protoreflect.FullName, msg []byte, metadata metadata.MD) (*GRPCResponse, error)
+	Invoke(fullName protoreflect.FullName, msg []byte, metadata metadata.MD, options InvokeOptions) (*GRPCResponse, error)
+	// Open opens bidirectional stream without sending messages, so they're sent one by one
+	Open(fullName protoreflect.FullName, metadata metadata.MD) (*GRPCResponse, error)
 	BuildRequest(desc protoreflect.MessageDescriptor, msg []byte) (*dynamicpb.Message, error)
 }
 
+// InvokeOptions are options of the call which are not sent as metadata
+type InvokeOptions struct {
+	// SendDelay is a pause before each message of client stream except the first one
+	SendDelay time.Duration
+}
+
 type Connection interface {
 	Invoke(ctx context.Context, fullName string, req, res interface{}) (header, trailer metadata.MD, err error)
 	Stream(ctx context.Context, fullName string, streamDesc *grpc.StreamDesc) (grpc.ClientStream, error)
+	Close() error
 }
@@ -0,0 +1,158 @@
+package proto
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	reflectionV1      = "grpc.reflection.v1.ServerReflection.ServerReflectionInfo"
+	reflectionV1Alpha = "grpc.reflection.v1alpha.ServerReflection.ServerReflectionInfo"
+	reflectionTimeout = 10 * time.Second
+)
+
+// reflectionSource resolves descriptors through the gRPC server reflection API of the target service.
+// Files are fetched lazily and registered together with all of their dependencies.
+// v1alpha messages are wire compatible with v1, so the same messages are used for both versions.
+// Requests carry metadata of the service, like the calls do, so servers which require auth can be reflected.
+// Test cases running in parallel share the source, so lookups are serialized.
+type reflectionSource struct {
+	mu   sync.Mutex
+	conn Connection
+	// metadata is read on each request, so substituted values of the service are sent
+	metadata map[string]string
+	method   string
+	builder  *filesBuilder
+	// missing are names the server doesn't know, they are not requested again
+	missing map[protoreflect.FullName]error
+}
+
+func newReflectionSource(conn Connection, metadata map[string]string) *reflectionSource {
+	source := &reflectionSource{
+		conn:     conn,
+		metadata: metadata,
+		method:   reflectionV1,
+		missing:  make(map[protoreflect.FullName]error),
+	}
+	source.builder = newFilesBuilder(source.fetchFile)
+
+	return source
+}
+
+func (s *reflectionSource) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d, err := s.builder.files.FindDescriptorByName(name); err == nil {
+		return d, nil
+	}
+	if err, ok := s.missing[name]; ok {
+		return nil, err
+	}
+
+	files, err := s.request(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: string(name)},
+	})
+	if err != nil {
+		err = errors.Wrapf(err, "error resolving symbol %s via reflection", name)
+		if status.Code(errors.Cause(err)) == codes.NotFound {
+			s.missing[name] = err
+		}
+
+		return nil, err
+	}
+
+	for _, file := range files {
+		if err := s.builder.register(file.GetName()); err != nil {
+			return nil, err
+		}
+	}
+
+	d, err := s.builder.files.FindDescriptorByName(name)
+	if errors.Is(err, protoregistry.NotFound) {
+		s.missing[name] = err
+	}
+
+	return d, err
+}
+
+func (s *reflectionSource) fetchFile(path string) error {
+	_, err := s.request(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: path},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "error fetching file %s via reflection", path)
+	}
+
+	return nil
+}
+
+func (s *reflectionSource) request(req *reflectionpb.ServerReflectionRequest) ([]*descriptorpb.FileDescriptorProto, error) {
+	res, err := s.call(req)
+	if status.Code(errors.Cause(err)) == codes.Unimplemented && s.method == reflectionV1 {
+		s.method = reflectionV1Alpha
+		res, err = s.call(req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if errRes := res.GetErrorResponse(); errRes != nil {
+		return nil, status.Error(codes.Code(errRes.GetErrorCode()), errRes.GetErrorMessage())
+	}
+
+	files := make([]*descriptorpb.FileDescriptorProto, 0)
+	for _, raw := range res.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		file := new(descriptorpb.FileDescriptorProto)
+		if err := protobuf.Unmarshal(raw, file); err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling file descriptor")
+		}
+
+		s.builder.add(file)
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+func (s *reflectionSource) call(req *reflectionpb.ServerReflectionRequest) (*reflectionpb.ServerReflectionResponse, error) {
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.New(s.metadata))
+	ctx, cancel := context.WithTimeout(ctx, reflectionTimeout)
+	defer cancel()
+
+	stream, err := s.conn.Stream(ctx, s.method, &grpc.StreamDesc{
+		StreamName:    "ServerReflectionInfo",
+		ServerStreams: true,
+		ClientStreams: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// in case of io.EOF the actual error is returned by RecvMsg
+	if err := stream.SendMsg(req); err != nil && !errors.Is(err, io.EOF) {
+		return nil, errors.Wrap(err, "error sending reflection request")
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, errors.Wrap(err, "error closing reflection stream")
+	}
+
+	res := new(reflectionpb.ServerReflectionResponse)
+	if err := stream.RecvMsg(res); err != nil {
+		return nil, errors.Wrap(err, "error receiving reflection response")
+	}
+
+	return res, nil
+}
@@ -0,0 +1,96 @@
+package proto
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/res-am/grpc-fts/internal/config"
+	"github.com/res-am/grpc-fts/internal/models"
+)
+
+// sourcesProvider decides where descriptors of the service should be looked for.
+// Service setting has priority over the global one, local proto files stay the fallback for reflection.
+type sourcesProvider struct {
+	mode       string
+	local      []descriptorSource
+	reflection map[string]*reflectionSource
+}
+
+func newSourcesProvider(cfg *config.Global, local []descriptorSource) (*sourcesProvider, error) {
+	if err := validateDescriptorsMode(cfg.Descriptors); err != nil {
+		return nil, err
+	}
+
+	return &sourcesProvider{
+		mode:       cfg.Descriptors,
+		local:      local,
+		reflection: make(map[string]*reflectionSource),
+	}, nil
+}
+
+func (p *sourcesProvider) get(name string, service config.Service) ([]descriptorSource, error) {
+	if err := validateDescriptorsMode(service.Descriptors); err != nil {
+		return nil, errors.Wrapf(err, "service %s", name)
+	}
+
+	mode := service.Descriptors
+	if mode == "" {
+		mode = p.mode
+	}
+
+	if mode != DescriptorsReflection {
+		return p.local, nil
+	}
+
+	source, err := p.reflectionSource(name, service)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]descriptorSource{source}, p.local...), nil
+}
+
+func (p *sourcesProvider) reflectionSource(name string, service config.Service) (descriptorSource, error) {
+	if source, ok := p.reflection[name]; ok {
+		return source, nil
+	}
+
+	conn, err := NewConnection(service.Address, service.TLS)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating reflection connection for service %s", name)
+	}
+
+	source := newReflectionSource(conn, service.Metadata)
+	p.reflection[name] = source
+
+	return source, nil
+}
+
+// reflectionSources returns reflection sources used so far
+func (p *sourcesProvider) reflectionSources() []descriptorSource {
+	sources := make([]descriptorSource, 0, len(p.reflection))
+	for _, source := range p.reflection {
+		sources = append(sources, source)
+	}
+
+	return sources
+}
+
+// close closes connections of reflection sources
+func (p *sourcesProvider) close() error {
+	for name, source := range p.reflection {
+		if err := source.conn.Close(); err != nil {
+			return errors.Wrapf(err, "error closing reflection connection for service %s", name)
+		}
+	}
+
+	return nil
+}
+
+func validateDescriptorsMode(mode string) error {
+	switch mode {
+	case "", DescriptorsLocal, DescriptorsReflection:
+		return nil
+	default:
+		return models.NewErr(fmt.Sprintf("unknown descriptors mode '%s', expected %s or %s", mode, DescriptorsLocal, DescriptorsReflection))
+	}
+}
@@ -0,0 +1,72 @@
+package proto
+
+import (
+	"fmt"
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails" // standard error details are always available
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"strings"
+)
+
+// typesResolver resolves message types of Any fields, like status details, through all descriptor sources.
+// Local sources and the global registry are looked up before reflection, so well-known types, standard error
+// details and compiled types don't cost a reflection request.
+type typesResolver struct {
+	local      []descriptorSource
+	reflection []descriptorSource
+}
+
+func newTypesResolver(local, reflection []descriptorSource) Resolver {
+	return &typesResolver{local: local, reflection: reflection}
+}
+
+func (r *typesResolver) FindMessageByName(name protoreflect.FullName) (protoreflect.MessageType, error) {
+	if message, ok := findMessage(name, r.local); ok {
+		return message, nil
+	}
+	if message, err := protoregistry.GlobalTypes.FindMessageByName(name); err == nil {
+		return message, nil
+	}
+	if message, ok := findMessage(name, r.reflection); ok {
+		return message, nil
+	}
+
+	return nil, protoregistry.NotFound
+}
+
+// findMessage returns type of the message from the first source which has it
+func findMessage(name protoreflect.FullName, sources []descriptorSource) (protoreflect.MessageType, bool) {
+	for _, source := range sources {
+		d, err := source.FindDescriptorByName(name)
+		if err != nil {
+			continue
+		}
+
+		if message, ok := d.(protoreflect.MessageDescriptor); ok {
+			return dynamicpb.NewMessageType(message), true
+		}
+	}
+
+	return nil, false
+}
+
+func (r *typesResolver) FindMessageByURL(url string) (protoreflect.MessageType, error) {
+	name := url
+	if i := strings.LastIndexByte(url, '/'); i >= 0 {
+		name = url[i+1:]
+	}
+	if !protoreflect.FullName(name).IsValid() {
+		return nil, fmt.Errorf("invalid type url %s", url)
+	}
+
+	return r.FindMessageByName(protoreflect.FullName(name))
+}
+
+func (r *typesResolver) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByName(field)
+}
+
+func (r *typesResolver) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return protoregistry.GlobalTypes.FindExtensionByNumber(message, field)
+}
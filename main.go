@@ -15,9 +15,15 @@ func main() {
 				Usage: "run all test cases",
 				Flags: []cli.Flag{
 					config.ConfigsFlagSetup,
+					config.EnvFlagSetup,
 					config.VarFlagSetup,
 					config.TargetFlagSetup,
 					config.VerboseFlagSetup,
+					config.ReportFlagSetup,
+					config.FailFastFlagSetup,
+					config.ParallelFlagSetup,
+					config.UpdateSnapshotsFlagSetup,
+					config.OutputFlagSetup,
 				},
 				Action: func(ctx *cli.Context) error {
 					return internal.NewContainer(ctx).RunTestCase()
@@ -28,12 +34,44 @@ func main() {
 				Usage: "validate configuration",
 				Flags: []cli.Flag{
 					config.ConfigsFlagSetup,
+					config.EnvFlagSetup,
+					config.VarFlagSetup,
 					config.VerboseFlagSetup,
+					config.OutputFlagSetup,
 				},
 				Action: func(ctx *cli.Context) error {
 					return internal.NewContainer(ctx).Validate()
 				},
 			},
+			{
+				Name:  "record",
+				Usage: "run the target test case and write actual responses to it as expectations",
+				Flags: []cli.Flag{
+					config.ConfigsFlagSetup,
+					config.EnvFlagSetup,
+					config.VarFlagSetup,
+					config.TargetFlagSetup,
+					config.VerboseFlagSetup,
+					config.IgnoreFlagSetup,
+				},
+				Action: func(ctx *cli.Context) error {
+					return internal.NewContainer(ctx).Record()
+				},
+			},
+			{
+				Name:  "mock",
+				Usage: "serve configured services with responses from stubs",
+				Flags: []cli.Flag{
+					config.ConfigsFlagSetup,
+					config.EnvFlagSetup,
+					config.VarFlagSetup,
+					config.VerboseFlagSetup,
+					config.ListenFlagSetup,
+				},
+				Action: func(ctx *cli.Context) error {
+					return internal.NewContainer(ctx).Mock()
+				},
+			},
 			{
 				Name:  "init",
 				Usage: "init fts project",